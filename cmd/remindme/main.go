@@ -0,0 +1,330 @@
+// Command remindme sends the payment reports of the configured sheets
+// (see the remindme package for the report pipeline)
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kkentzo/remindme"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed config.yml
+var configFileContents string
+
+func main() {
+	command, args := parseCommand(os.Args[1:])
+	if command != "version" {
+		// fail fast (e.g. on a broken ZONEINFO)
+		if err := remindme.CheckTimeZone(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch command {
+	case "run":
+		runCommand(args)
+	case "check":
+		checkCommand(args)
+	case "dump-config":
+		dumpConfigCommand(args)
+	case "version":
+		fmt.Println(remindme.Version)
+	default:
+		log.Fatalf("unknown command '%s' (expected one of run, check, dump-config, version)", command)
+	}
+}
+
+// parseCommand splits the subcommand from its args; run is the default
+// command when the args start with a flag (or are empty)
+func parseCommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "run", args
+	}
+	return args[0], args[1:]
+}
+
+// configFlags adds the config flags to fs and returns a loader of the
+// config they point to
+func configFlags(fs *flag.FlagSet) func() *remindme.Config {
+	getConfigs := configsFlags(fs)
+	return func() *remindme.Config {
+		return getConfigs(false)[0]
+	}
+}
+
+// configsFlags adds the config flags to fs and returns a loader of the
+// configs they point to (one per file of -config-dir with perFile)
+func configsFlags(fs *flag.FlagSet) func(perFile bool) []*remindme.Config {
+	path := fs.String("config", "", "Read the config from this file instead of the embedded one")
+	format := fs.String("config-format", "", "The config file format (yaml, json or toml) -- detected from the file extension by default")
+	dir := fs.String("config-dir", "", "Combine the config files (yaml) of this directory into one config")
+	return func(perFile bool) []*remindme.Config {
+		if *dir != "" {
+			configs, err := remindme.LoadConfigDir(*dir, perFile)
+			if err != nil {
+				log.Fatalf("Unable to parse config dir: %v", err)
+			}
+			return configs
+		}
+		config, err := loadConfig(*path, *format)
+		if err != nil {
+			log.Fatalf("Unable to parse config file: %v", err)
+		}
+		return []*remindme.Config{config}
+	}
+}
+
+func runCommand(args []string) {
+	opts := &remindme.RunOptions{}
+	var (
+		cronMode bool
+		addr     string
+	)
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.BoolVar(&opts.Print, "print", false, "Print the report on screen as well")
+	noColor := fs.Bool("no-color", false, "Print the report without colors (even on a terminal)")
+	fs.StringVar(&opts.Out, "out", "", "Write the report to this file as well")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "Build the report without sending it")
+	fs.BoolVar(&cronMode, "cron", true, "Enable/disable cron mode")
+	fs.StringVar(&addr, "addr", ":8080", "The address of the http server (in cron mode)")
+	fs.StringVar(&opts.OnlyTag, "only-tag", "", "Restrict the report to payments tagged with #TAG in their description")
+	perConfig := fs.Bool("per-config", false, "Send a report per file of -config-dir (instead of a combined one)")
+	asOf := fs.String("as-of", "", "Print the report as of this date (YYYY-MM-DD) without sending it (implies -cron=false)")
+	// the flags that preceded the check and dump-config commands are kept
+	// as aliases of them
+	checkMode := fs.Bool("check", false, "Deprecated: use the check command")
+	dumpMode := fs.Bool("dump-config", false, "Deprecated: use the dump-config command")
+	getConfigs := configsFlags(fs)
+	fs.Parse(args)
+	if *dumpMode {
+		log.Printf("-dump-config is deprecated (use the dump-config command)")
+		dumpConfig(getConfigs(false)[0])
+		return
+	}
+	if *checkMode {
+		log.Printf("-check is deprecated (use the check command)")
+		check(getConfigs(false)[0])
+		return
+	}
+	if *asOf != "" {
+		now, err := remindme.ParseAsOf(*asOf, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Now, opts.Print, opts.DryRun, cronMode = now, true, true, false
+	}
+	// colors are only used on terminals (and not if NO_COLOR is set)
+	opts.Color = !*noColor && os.Getenv("NO_COLOR") == "" && remindme.IsTerminal(os.Stdout)
+
+	log.Printf("cron_mode=%v", cronMode)
+
+	// the combined config is used for everything but the reports of
+	// -per-config runs
+	config := getConfigs(false)[0]
+	log.Printf("Found %d sheets", len(config.Sheets))
+
+	readers, err := remindme.NewReaders(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configs, configReaders := []*remindme.Config{config}, []*remindme.Readers{readers}
+	if *perConfig {
+		configs, configReaders = getConfigs(true), []*remindme.Readers{}
+		for _, c := range configs {
+			r, err := remindme.NewReaders(c)
+			if err != nil {
+				log.Fatal(err)
+			}
+			configReaders = append(configReaders, r)
+		}
+		log.Printf("sending a report per config (%d configs)", len(configs))
+	}
+	client, err := remindme.NewHTTPClient(config.HTTPProxy, config.UserAgent)
+	if err != nil {
+		log.Fatal(err)
+	}
+	notifier := &remindme.NtfyNotifier{Client: client}
+	// send the deferred reports whose quiet hours are over
+	deliverPending := func() {
+		for _, c := range configs {
+			if !c.HasQuietHours() || c.QuietHoursMode != remindme.QuietHoursDefer {
+				continue
+			}
+			if err := remindme.DeliverPending(remindme.NewFileStateStore(c.StateFile), notifier, time.Now()); err != nil {
+				log.Printf(err.Error())
+			}
+		}
+	}
+	runAll := func() {
+		for i, c := range configs {
+			if err := remindme.Run(c, configReaders[i], notifier, opts); err != nil {
+				log.Printf(err.Error())
+				remindme.ReportFailure(c, notifier, err)
+			}
+		}
+	}
+
+	if cronMode {
+		// runs that overlap with a still running one are skipped (and logged)
+		skipLogger := cron.VerbosePrintfLogger(log.Default())
+		c := cron.New(cron.WithLocation(remindme.GreekTimeZone()), cron.WithParser(config.CronParser()), cron.WithChain(cron.SkipIfStillRunning(skipLogger)))
+		// runs (and deliveries of deferred reports) never overlap
+		var running sync.Mutex
+		runOnce := func() {
+			running.Lock()
+			defer running.Unlock()
+			runAll()
+		}
+		job := func() {
+			// the slot of the run is taken before it's delayed so that all
+			// instances lock the same one
+			slot := config.LockSlot(time.Now())
+			if config.ScheduleJitter > 0 {
+				// spread the load of instances sharing the same schedule
+				delay := time.Duration(rand.Int63n(int64(config.ScheduleJitter)))
+				log.Printf("delaying run by %v", delay)
+				time.Sleep(delay)
+			}
+			if config.LockFile == "" {
+				runOnce()
+				return
+			}
+			lock, err := remindme.AcquireRunLock(config.LockFile, slot, time.Now())
+			if err != nil {
+				log.Printf("skipping run of %s: %v", slot.Format(time.RFC3339), err)
+				return
+			}
+			runOnce()
+			if err := lock.Release(time.Now()); err != nil {
+				log.Printf("failed to release the run lock: %v", err)
+			}
+		}
+
+		var watches *remindme.Watches
+		if config.WatchChanges {
+			watches, err = remindme.NewWatches(config, client)
+			if err == nil {
+				err = watches.Start()
+			}
+			if err != nil {
+				log.Printf("failed to watch spreadsheets for changes (using only the schedule): %v", err)
+				watches = nil
+			} else {
+				log.Printf("watching %d spreadsheets for changes (until %s)", watches.Len(), watches.Expiration().Format(time.RFC3339))
+				go watches.Keep()
+			}
+		}
+		// changes trigger runs in addition to the schedule (which keeps
+		// reminding of delayed and due payments)
+		for _, schedule := range config.CronSchedule {
+			if _, err := c.AddFunc(schedule, job); err != nil {
+				log.Fatalf("failed to setup cron: %v", err)
+			}
+		}
+
+		c.Start()
+
+		nextRun := func() time.Time { return remindme.NextRun(c.Entries()) }
+		log.Printf("started cron with schedule='%s' in the %s format (next run at %s)", strings.Join(config.CronSchedule, "', '"), config.CronFormat(), nextRun().Format(time.RFC3339))
+
+		server := remindme.NewServer(nextRun)
+		// the changes caused by the paid buttons do not trigger runs
+		writes := remindme.NewWriteTracker()
+		if watches != nil {
+			server.WithChangeHandler(remindme.NewChangeHandler(config.CallbackSecret, writes, remindme.Debounce(remindme.WatchDebounce, runOnce)))
+		}
+		go func() {
+			for range time.Tick(time.Minute) {
+				running.Lock()
+				deliverPending()
+				running.Unlock()
+			}
+		}()
+		if config.RunSecret != "" {
+			server.WithRunHandler(remindme.NewRunHandler(config.RunSecret, func() (string, error) {
+				running.Lock()
+				defer running.Unlock()
+				reports := []string{}
+				runOpts := *opts
+				runOpts.OnReport = func(report string) { reports = append(reports, report) }
+				for i, c := range configs {
+					if err := remindme.Run(c, configReaders[i], notifier, &runOpts); err != nil {
+						return "", err
+					}
+				}
+				return strings.Join(reports, "\n\n"), nil
+			}))
+		}
+		if config.CallbackURL != "" {
+			server.WithPaidHandler(remindme.NewPaidHandler(config.CallbackSecret, func(spreadsheetId string) remindme.SheetWriter {
+				return writes.Track(readers.WriterFor(config.Sheets, spreadsheetId))
+			}, func(cell *remindme.PaidCell) (*remindme.Payment, error) {
+				return remindme.PaymentAt(readers, config.Sheets, cell, time.Now())
+			}))
+		}
+		log.Printf("listening on %s", addr)
+		log.Fatal(http.ListenAndServe(addr, server.Handler()))
+	} else {
+		// one-off runs (e.g. of an external scheduler) deliver the report
+		// deferred by an earlier run first
+		if !opts.DryRun {
+			deliverPending()
+		}
+		runAll()
+	}
+}
+
+// checkCommand checks that all sheets can be read
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	getConfig := configFlags(fs)
+	fs.Parse(args)
+	check(getConfig())
+}
+
+// check exits with an error if any of the sheets can not be read
+func check(config *remindme.Config) {
+	readers, err := remindme.NewReaders(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := remindme.Check(config, readers, os.Stdout); err != nil {
+		log.Fatalf("check failed: %v", err)
+	}
+}
+
+// dumpConfigCommand prints the effective config (with secrets redacted)
+func dumpConfigCommand(args []string) {
+	fs := flag.NewFlagSet("dump-config", flag.ExitOnError)
+	getConfig := configFlags(fs)
+	fs.Parse(args)
+	dumpConfig(getConfig())
+}
+
+// dumpConfig prints the config with its secrets redacted
+func dumpConfig(config *remindme.Config) {
+	contents, err := yaml.Marshal(config.Redacted())
+	if err != nil {
+		log.Fatalf("Unable to dump config: %v", err)
+	}
+	fmt.Print(string(contents))
+}
+
+// loadConfig parses the config file at path (or the embedded config if
+// path is empty) in the given format (or the one implied by its extension)
+func loadConfig(path, format string) (*remindme.Config, error) {
+	if path == "" {
+		return remindme.ParseConfig([]byte(configFileContents))
+	}
+	return remindme.LoadConfig(path, format)
+}
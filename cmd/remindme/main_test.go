@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseCommand(t *testing.T) {
+	kases := []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{[]string{}, "run", []string{}},
+		{[]string{"-cron=false", "-print"}, "run", []string{"-cron=false", "-print"}},
+		{[]string{"check", "-config", "foo.yml"}, "check", []string{"-config", "foo.yml"}},
+		{[]string{"version"}, "version", []string{}},
+	}
+	for _, kase := range kases {
+		command, rest := parseCommand(kase.args)
+		assert.Equal(t, kase.command, command, kase.args)
+		assert.Equal(t, kase.rest, rest, kase.args)
+	}
+}
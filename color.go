@@ -0,0 +1,61 @@
+package remindme
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	ansiReset   = "\033[0m"
+	ansiRed     = "\033[31m"
+	ansiGreen   = "\033[32m"
+	ansiYellow  = "\033[33m"
+	ansiBlue    = "\033[34m"
+	ansiMagenta = "\033[35m"
+	ansiCyan    = "\033[36m"
+	ansiFaint   = "\033[2m"
+)
+
+// the colors of the report's lines by their leading emoji
+var lineColors = []struct {
+	prefix string
+	color  string
+}{
+	{"❗", ansiMagenta},
+	{"🚨", ansiRed},
+	{"⚠", ansiRed},
+	{"🦕", ansiRed},
+	{"💸", ansiYellow},
+	{"⏳", ansiCyan},
+	{"📅", ansiBlue},
+	{"📌", ansiFaint},
+	{"ℹ", ansiFaint},
+	{"💰", ansiGreen},
+	{"📊", ansiGreen},
+}
+
+// Colorize wraps the prefix of each report line (up to its first colon or
+// the whole line if there is none) in the ANSI color of its section
+func Colorize(report string) string {
+	lines := strings.Split(report, "\n")
+	for idx, line := range lines {
+		for _, c := range lineColors {
+			if !strings.HasPrefix(line, c.prefix) {
+				continue
+			}
+			end := strings.Index(line, ":") + 1
+			if end == 0 {
+				end = len(line)
+			}
+			lines[idx] = c.color + line[:end] + ansiReset + line[end:]
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsTerminal reports whether f is a terminal (i.e. a character device)
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,27 @@
+package remindme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Colorize(t *testing.T) {
+	report := "⚠ Delayed: water\n🦕 2 payments overdue for more than 90 days\n💸 Today: rent\nNothing coming up\n💰 Total 3 payments pending during the next 30 days"
+	expected := ansiRed + "⚠ Delayed:" + ansiReset + " water\n" +
+		ansiRed + "🦕 2 payments overdue for more than 90 days" + ansiReset + "\n" +
+		ansiYellow + "💸 Today:" + ansiReset + " rent\n" +
+		"Nothing coming up\n" +
+		ansiGreen + "💰 Total 3 payments pending during the next 30 days" + ansiReset
+	assert.Equal(t, expected, Colorize(report))
+}
+
+func Test_IsTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	require.NoError(t, err)
+	defer f.Close()
+	assert.False(t, IsTerminal(f))
+}
@@ -0,0 +1,137 @@
+package remindme
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile holds the (raw) settings of a file of the config dir
+type configFile struct {
+	name   string
+	values map[string]interface{}
+}
+
+// LoadConfigDir loads the yaml files of dir (in name order) as a single
+// config that reports the sheets of all files; each global setting is
+// taken from the first file that sets it (conflicting values of later
+// files are ignored and logged) apart from a file's credentials which are
+// used for its own sheets -- with perFile, a config is returned for each
+// file instead with the file's settings (e.g. its ntfy_topic) overriding
+// the combined ones (files without sheets, e.g. of common settings, are
+// skipped)
+func LoadConfigDir(dir string, perFile bool) ([]*Config, error) {
+	files, err := readConfigDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	combined := mergeConfigFiles(files)
+	if !perFile {
+		config, err := parseConfigValues(combined)
+		if err != nil {
+			return nil, err
+		}
+		return []*Config{config}, nil
+	}
+	configs := []*Config{}
+	for _, file := range files {
+		if sheets, _ := file.values["sheets"].([]interface{}); len(sheets) == 0 {
+			continue
+		}
+		values := map[string]interface{}{}
+		for key, value := range combined {
+			if key != "sheets" {
+				values[key] = value
+			}
+		}
+		for key, value := range file.values {
+			values[key] = value
+		}
+		config, err := parseConfigValues(values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file.name, err)
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no config file of %s has sheets", dir)
+	}
+	return configs, nil
+}
+
+func readConfigDir(dir string) ([]*configFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []*configFile{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal(contents, &values); err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		files = append(files, &configFile{name: entry.Name(), values: values})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config files found in %s", dir)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// mergeConfigFiles combines the settings of the files (see LoadConfigDir)
+func mergeConfigFiles(files []*configFile) map[string]interface{} {
+	merged := map[string]interface{}{}
+	owners := map[string]string{}
+	for _, file := range files {
+		for key, value := range file.values {
+			if key == "sheets" {
+				continue
+			}
+			if _, ok := merged[key]; !ok {
+				merged[key] = value
+				owners[key] = file.name
+			} else if !reflect.DeepEqual(merged[key], value) && key != "credentials" {
+				log.Printf("config dir: ignoring %s of %s (using the one of %s)", key, file.name, owners[key])
+			}
+		}
+	}
+	sheets := []interface{}{}
+	for _, file := range files {
+		list, _ := file.values["sheets"].([]interface{})
+		credentials, hasCredentials := file.values["credentials"]
+		for _, item := range list {
+			sheet, ok := item.(map[string]interface{})
+			// the sheets of files with other credentials use them as their own
+			if ok && hasCredentials && !reflect.DeepEqual(credentials, merged["credentials"]) &&
+				sheet["credentials"] == nil && sheet["credentials_file"] == nil {
+				sheet["credentials"] = credentials
+			}
+			sheets = append(sheets, item)
+		}
+	}
+	merged["sheets"] = sheets
+	return merged
+}
+
+func parseConfigValues(values map[string]interface{}) (*Config, error) {
+	contents, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(contents)
+}
@@ -0,0 +1,74 @@
+package remindme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"00-common.yml": "ntfy_topic: common\ncoming_up_days: 3\ncredentials: common-credentials\n",
+		"10-acme.yaml": `
+ntfy_topic: acme
+coming_up_days: 5
+sheets:
+  - spreadsheet_id: abc
+    name: invoices
+`,
+		"20-initech.yml": `
+credentials: initech-credentials
+sheets:
+  - spreadsheet_id: xyz
+    name: bills
+  - spreadsheet_id: xyz
+    name: other
+    credentials_file: other.json
+`,
+		"notes.txt": "not a config",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	configs, err := LoadConfigDir(dir, false)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	config := configs[0]
+	// the first file that sets a setting wins
+	assert.Equal(t, "common", config.NotificationTopic)
+	assert.Equal(t, 3, config.ComingUpDays)
+	assert.Equal(t, "common-credentials", config.Credentials)
+	require.Len(t, config.Sheets, 3)
+	assert.Equal(t, "invoices", config.Sheets[0].Name)
+	assert.Equal(t, "", config.Sheets[0].Credentials)
+	// the sheets of a file use its credentials
+	assert.Equal(t, "initech-credentials", config.Sheets[1].Credentials)
+	assert.Equal(t, "", config.Sheets[2].Credentials)
+	assert.Equal(t, "other.json", config.Sheets[2].CredentialsFile)
+
+	// the common file has no sheets (and no report of its own)
+	configs, err = LoadConfigDir(dir, true)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, "acme", configs[0].NotificationTopic)
+	assert.Equal(t, 5, configs[0].ComingUpDays)
+	require.Len(t, configs[0].Sheets, 1)
+	assert.Equal(t, "common", configs[1].NotificationTopic)
+	assert.Equal(t, "initech-credentials", configs[1].Credentials)
+	assert.Len(t, configs[1].Sheets, 2)
+
+	common := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(common, "00-common.yml"), []byte(files["00-common.yml"]), 0644))
+	_, err = LoadConfigDir(common, true)
+	assert.Error(t, err)
+
+	_, err = LoadConfigDir(t.TempDir(), false)
+	assert.Error(t, err)
+	_, err = LoadConfigDir(filepath.Join(dir, "missing"), false)
+	assert.Error(t, err)
+}
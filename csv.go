@@ -0,0 +1,54 @@
+package remindme
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+)
+
+// CSVSheetReader reads sheets from local csv files; each file contains a
+// single sheet so the requested sheet names are only used as keys
+type CSVSheetReader struct{}
+
+func (r *CSVSheetReader) Read(path string, sheetNames ...string) (map[string][][]interface{}, error) {
+	rows, err := readCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][][]interface{}{}
+	for _, name := range sheetNames {
+		values[name] = rows
+	}
+	return values, nil
+}
+
+// List returns the file name as the file's only sheet
+func (r *CSVSheetReader) List(path string) ([]string, error) {
+	return []string{filepath.Base(path)}, nil
+}
+
+// readCSV loads the records of a csv file in the shape of the sheets api values
+func readCSV(path string) ([][]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	// rows may omit trailing empty cells
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rows := [][]interface{}{}
+	for _, record := range records {
+		row := []interface{}{}
+		for _, cell := range record {
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
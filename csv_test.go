@@ -0,0 +1,34 @@
+package remindme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CSVSheetReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.csv")
+	contents := "Description,Due Date,Payment Date\nfoo,2023-11-04,\nbar,2023-11-05,2023-11-05\nbaz,2023-11-06\n"
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+
+	reader := &CSVSheetReader{}
+	values, err := reader.Read(path, "payments")
+	require.NoError(t, err)
+	rows := values["payments"]
+	require.Equal(t, 4, len(rows))
+	assert.Equal(t, []interface{}{"foo", "2023-11-04", ""}, rows[1])
+	assert.Equal(t, []interface{}{"baz", "2023-11-06"}, rows[3])
+
+	payments, err := readPayments(rows, &Sheet{Source: SourceCSV, Path: path}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(payments))
+	assert.Equal(t, "foo", payments[0].description)
+	assert.Equal(t, "baz", payments[1].description)
+
+	_, err = reader.Read(filepath.Join(t.TempDir(), "missing.csv"), "payments")
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package remindme
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DetailsHeader is the header row of the details attachment
+var DetailsHeader = []string{"Description", "Due Date", "Days", "Amount", "Currency", "Category", "Tags", "Optional", "Sheet"}
+
+// PaymentsCSV lists the payments (most urgent first) along with their
+// amounts and sheets as csv (for the details attachment of reports)
+func PaymentsCSV(payments []*Payment, now time.Time) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write(DetailsHeader); err != nil {
+		return nil, err
+	}
+	for _, p := range SortPaymentsByDueDate(payments) {
+		due, days, amount := "", "", ""
+		if p.IsDue() {
+			due = p.due.Format(time.DateOnly)
+			if p.hasDueTime {
+				due = p.dueTime.Format("2006-01-02 15:04")
+			}
+			days = strconv.Itoa(p.DiffFromNowInDays(now))
+		}
+		if p.hasAmount {
+			amount = strconv.FormatFloat(p.amount, 'f', 2, 64)
+		}
+		record := []string{p.description, due, days, amount, p.currency, p.category, strings.Join(p.tags, " "), strconv.FormatBool(p.optional), p.sheet}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DetailsFilename is the file name of the details attachment of a report
+func DetailsFilename(now time.Time) string {
+	return fmt.Sprintf("payments-%s.csv", now.In(GreekTimeZone()).Format(time.DateOnly))
+}
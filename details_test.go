@@ -0,0 +1,79 @@
+package remindme
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PaymentsCSV(t *testing.T) {
+	now := timeFromDate(t, "2023-11-15")
+	payments := []*Payment{
+		NewPayment("rent").WithDueDate(timeFromDate(t, "2023-11-20")).WithAmount(850).WithCurrency("EUR").WithCategory("housing"),
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-12")).WithTags("utilities", "home"),
+		NewPayment("gift, \"big\""),
+	}
+	payments[0].sheet = "household"
+
+	details, err := PaymentsCSV(payments, now)
+	require.NoError(t, err)
+	assert.Equal(t, `Description,Due Date,Days,Amount,Currency,Category,Tags,Optional,Sheet
+water,2023-11-12,-3,,,,utilities home,false,
+rent,2023-11-20,5,850.00,EUR,housing,,false,household
+"gift, ""big""",,,,,,,false,
+`, string(details))
+	assert.Equal(t, "payments-2023-11-15.csv", DetailsFilename(now))
+}
+
+func Test_NewNotificationRequest_Attachment(t *testing.T) {
+	req, err := newNotificationRequest(DefaultNtfyServer, &Notification{
+		Topic:      "foo",
+		Title:      "bar",
+		Message:    "⚠️ Delayed: water",
+		Attachment: []byte("Description\nwater\n"),
+		Filename:   "payments.csv",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, "https://ntfy.sh/foo", req.URL.String())
+	assert.Equal(t, "bar", req.Header.Get("Title"))
+	assert.Equal(t, "payments.csv", req.Header.Get("Filename"))
+	message, err := new(mime.WordDecoder).DecodeHeader(req.Header.Get("Message"))
+	require.NoError(t, err)
+	assert.Equal(t, "⚠️ Delayed: water", message)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "Description\nwater\n", string(body))
+}
+
+func Test_Run_AttachDetails(t *testing.T) {
+	reader := &fakeSheetReader{sheets: map[string]map[string][][]interface{}{
+		"abc": {"household": {
+			{"Description", "Due Date", "Amount", "Payment Date"},
+			{"water", "2023-11-12", "30", ""},
+			{"rent", "2023-12-20", "850", ""},
+		}},
+	}}
+	config, err := ParseConfig([]byte(`
+ntfy_topic: topic
+attach_details: true
+sheets:
+  - spreadsheet_id: abc
+    name: household
+`))
+	require.NoError(t, err)
+
+	notifier := &stubNotifier{}
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: timeFromDate(t, "2023-11-15")}))
+	require.Len(t, notifier.notifications, 1)
+	n := notifier.notifications[0]
+	assert.Equal(t, "payments-2023-11-15.csv", n.Filename)
+	// the attachment lists the payments that are not part of the report too
+	assert.Contains(t, string(n.Attachment), "water,2023-11-12,-3,30.00,")
+	assert.Contains(t, string(n.Attachment), "rent,2023-12-20,35,850.00,")
+	assert.Contains(t, string(n.Attachment), ",household\n")
+}
@@ -3,8 +3,10 @@ module github.com/kkentzo/remindme
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/robfig/cron/v3 v3.0.0
 	github.com/stretchr/testify v1.8.4
+	github.com/xuri/excelize/v2 v2.8.0
 	golang.org/x/oauth2 v0.13.0
 	google.golang.org/api v0.149.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -20,7 +22,12 @@ require (
 	github.com/google/uuid v1.4.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.2 // indirect
 	github.com/googleapis/gax-go/v2 v2.12.0 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.3 // indirect
+	github.com/xuri/efp v0.0.0-20230802181842-ad255f2331ca // indirect
+	github.com/xuri/nfp v0.0.0-20230819163627-dc951e3ffe1a // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
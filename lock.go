@@ -0,0 +1,111 @@
+package remindme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrLockHeld is returned when another instance has taken the lock of a run
+var ErrLockHeld = errors.New("the run is locked by another instance")
+
+// LockRetention is how long the lock files of past runs are kept around
+const LockRetention = 7 * 24 * time.Hour
+
+const lockSlotFormat = "20060102T150405"
+
+// RunLock is the lock of a scheduled run that is shared by all instances
+// through a file (e.g. on a shared volume) -- each scheduled time (slot)
+// has its own lock file which is created exclusively so only a single
+// instance gets to send the report of the slot; released locks are kept
+// (as the record of the slot) so that instances that fire later (e.g. due
+// to schedule_jitter) still skip the run
+type RunLock struct {
+	path   string
+	holder *lockHolder
+}
+
+type lockHolder struct {
+	Holder   string     `json:"holder"`
+	Acquired time.Time  `json:"acquired"`
+	Released *time.Time `json:"released,omitempty"`
+}
+
+// AcquireRunLock takes the lock of the run scheduled at slot; it fails with
+// ErrLockHeld if the lock has been taken already (by any instance)
+func AcquireRunLock(path string, slot, now time.Time) (*RunLock, error) {
+	lockPath := fmt.Sprintf("%s.%s", path, slot.UTC().Format(lockSlotFormat))
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		holder := &lockHolder{}
+		if contents, err := os.ReadFile(lockPath); err == nil {
+			json.Unmarshal(contents, holder)
+		}
+		return nil, fmt.Errorf("%w (%s)", ErrLockHeld, holder.Holder)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the lock file: %v", err)
+	}
+	lock := &RunLock{path: lockPath, holder: &lockHolder{Holder: lockHolderName(), Acquired: now}}
+	err = json.NewEncoder(f).Encode(lock.holder)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(lockPath)
+		return nil, fmt.Errorf("failed to write the lock file: %v", err)
+	}
+	removeExpiredLocks(path, now)
+	return lock, nil
+}
+
+// Release marks the lock as released (once the run has completed)
+func (l *RunLock) Release(now time.Time) error {
+	l.holder.Released = &now
+	contents, err := json.Marshal(l.holder)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, contents, 0644)
+}
+
+// lockHolderName identifies the instance that holds a lock
+func lockHolderName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// removeExpiredLocks removes the lock files of the slots older than
+// LockRetention
+func removeExpiredLocks(path string, now time.Time) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return
+	}
+	for _, match := range matches {
+		slot, err := time.Parse(lockSlotFormat, strings.TrimPrefix(match, path+"."))
+		if err != nil || now.Sub(slot) <= LockRetention {
+			continue
+		}
+		if err := os.Remove(match); err != nil {
+			log.Printf("failed to remove expired lock file %s: %v", match, err)
+		}
+	}
+}
+
+// LockSlot is the scheduled time of a run that starts at now (i.e. now
+// truncated to the precision of the schedules)
+func (c *Config) LockSlot(now time.Time) time.Time {
+	if c.CronWithSeconds {
+		return now.Truncate(time.Second)
+	}
+	return now.Truncate(time.Minute)
+}
@@ -0,0 +1,49 @@
+package remindme
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AcquireRunLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remindme.lock")
+	slot := time.Date(2023, time.November, 15, 7, 5, 0, 0, time.UTC)
+	now := slot.Add(20 * time.Second)
+
+	lock, err := AcquireRunLock(path, slot, now)
+	require.NoError(t, err)
+	// the slot can not be locked again (even after the run)
+	_, err = AcquireRunLock(path, slot, now)
+	assert.ErrorIs(t, err, ErrLockHeld)
+	require.NoError(t, lock.Release(now.Add(time.Minute)))
+	_, err = AcquireRunLock(path, slot, now.Add(2*time.Minute))
+	assert.ErrorIs(t, err, ErrLockHeld)
+
+	contents, err := os.ReadFile(path + ".20231115T070500")
+	require.NoError(t, err)
+	holder := &lockHolder{}
+	require.NoError(t, json.Unmarshal(contents, holder))
+	assert.Equal(t, lockHolderName(), holder.Holder)
+	assert.True(t, now.Equal(holder.Acquired))
+	require.NotNil(t, holder.Released)
+	assert.True(t, now.Add(time.Minute).Equal(*holder.Released))
+
+	// other slots have their own locks and the expired ones are removed
+	next := slot.Add(LockRetention + time.Hour)
+	_, err = AcquireRunLock(path, next, next)
+	require.NoError(t, err)
+	_, err = os.Stat(path + ".20231115T070500")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_Config_LockSlot(t *testing.T) {
+	now := time.Date(2023, time.November, 15, 9, 5, 2, 300, time.UTC)
+	assert.Equal(t, time.Date(2023, time.November, 15, 9, 5, 0, 0, time.UTC), (&Config{}).LockSlot(now))
+	assert.Equal(t, time.Date(2023, time.November, 15, 9, 5, 2, 0, time.UTC), (&Config{CronWithSeconds: true}).LockSlot(now))
+}
@@ -1,41 +1,103 @@
-package main
+// Package remindme reads the pending payments of google spreadsheets (or
+// local csv/xlsx files) and reports them as ntfy notifications; the
+// remindme command (cmd/remindme) runs the reports on a schedule
+package remindme
 
 import (
+	"bytes"
 	"context"
-	_ "embed"
+	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"math/rand"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	// embed the time zone database (~450KB) which is used when the system
+	// one is missing (e.g. in scratch/distroless images)
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	"github.com/robfig/cron/v3"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"golang.org/x/oauth2/jwt"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 	"gopkg.in/yaml.v3"
 )
 
-//go:embed config.yml
-var configFileContents string
+var (
+	greekZoneOnce sync.Once
+	greekZone     *time.Location
+	greekZoneErr  error
+)
 
-var _GR *time.Location
+// LoadGreekTimeZone loads the athens time zone (once)
+func LoadGreekTimeZone() (*time.Location, error) {
+	greekZoneOnce.Do(func() {
+		greekZone, greekZoneErr = time.LoadLocation("Europe/Athens")
+		if greekZoneErr != nil {
+			greekZoneErr = fmt.Errorf("failed to load the Europe/Athens time zone: %v (check the ZONEINFO env var)", greekZoneErr)
+		}
+	})
+	return greekZone, greekZoneErr
+}
 
+// GreekTimeZone returns the athens time zone; it panics if the zone can not
+// be loaded, which CheckTimeZone (or LoadGreekTimeZone) reports as an error
+// beforehand
 func GreekTimeZone() *time.Location {
-	if _GR == nil {
-		loc, err := time.LoadLocation("Europe/Athens")
-		if err != nil {
-			log.Fatalf("error loading location: %v", err)
+	loc, err := LoadGreekTimeZone()
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// CheckTimeZone loads the athens time zone and checks its offsets (and the
+// date math that depends on them) so that a missing or broken time zone
+// database fails at startup rather than during a run
+func CheckTimeZone() error {
+	loc, err := LoadGreekTimeZone()
+	if err != nil {
+		return err
+	}
+	kases := []struct {
+		utc    time.Time
+		offset int
+		date   string
+	}{
+		// winter (EET) and summer (EEST) time
+		{time.Date(2023, time.January, 15, 22, 30, 0, 0, time.UTC), 2 * 60 * 60, "2023-01-16"},
+		{time.Date(2023, time.July, 15, 21, 30, 0, 0, time.UTC), 3 * 60 * 60, "2023-07-16"},
+	}
+	for _, kase := range kases {
+		if _, offset := kase.utc.In(loc).Zone(); offset != kase.offset {
+			return fmt.Errorf("unexpected offset of the Europe/Athens time zone at %s: %ds (expected %ds) -- check the time zone database", kase.utc.Format(time.RFC3339), offset, kase.offset)
+		}
+		if date := ToDate(kase.utc.In(loc)).Format(time.DateOnly); date != kase.date {
+			return fmt.Errorf("unexpected athens date of %s: %s (expected %s)", kase.utc.Format(time.RFC3339), date, kase.date)
 		}
-		_GR = loc
 	}
-	return _GR
+	return nil
 }
 
 func ToDate(t time.Time) time.Time {
@@ -45,351 +107,3285 @@ func ToDate(t time.Time) time.Time {
 type Sheet struct {
 	SpreadsheetId string `yaml:"spreadsheet_id"`
 	Name          string `yaml:"name"`
-	Type          string `yaml:"type"`
+	// the payments of priority sheets are always reported (normal sheets
+	// are reported according to the time windows of each section)
+	Type string `yaml:"type"`
+	// when name is "*", tabs matching this (glob) pattern are not read
+	Exclude string `yaml:"exclude"`
+	// payments with no due date are due net_days after the date found
+	// in this column (e.g. an invoice date)
+	DateColumn string `yaml:"date_column"`
+	NetDays    int    `yaml:"net_days"`
+	// the label of the column with the date each payment was paid on
+	// (default: Payment Date)
+	PaymentDateColumn string `yaml:"payment_date_column"`
+	// where the sheet is read from (google or csv) and the path of the
+	// file for file-based sources
+	Source string `yaml:"source"`
+	Path   string `yaml:"path"`
+	// google credentials (inline or in a file) to use for this sheet
+	// instead of the global ones
+	Credentials     string `yaml:"credentials"`
+	CredentialsFile string `yaml:"credentials_file"`
+	// the decimal separator of the sheet's amounts (defaults to the
+	// global decimal_separator)
+	DecimalSeparator string `yaml:"decimal_separator"`
+	// the (zero-based) index of the header row -- rows above it (e.g. a
+	// title) are ignored
+	HeaderRow int `yaml:"header_row"`
+	// rows whose value in status_column is one of paid_statuses (default:
+	// Paid) or skip_statuses (e.g. Cancelled) are skipped -- the payment
+	// date column is optional for sheets with a status column
+	StatusColumn string   `yaml:"status_column"`
+	PaidStatuses []string `yaml:"paid_statuses"`
+	SkipStatuses []string `yaml:"skip_statuses"`
+	// disabled sheets are not read (enabled by default)
+	Enabled *bool `yaml:"enabled"`
+	// the compiled description_strip of the config (if any)
+	descriptionStrip *regexp.Regexp
+	// the ack_prefix of the config (if any)
+	ackPrefix string
+	// the strict_headers of the config
+	strictHeaders bool
 }
 
-type Config struct {
-	NotificationTopic string   `yaml:"ntfy_topic"`
-	CronSchedule      string   `yaml:"cron_schedule"`
-	Credentials       string   `yaml:"credentials"`
-	Sheets            []*Sheet `yaml:"sheets"`
-}
+const (
+	SourceGoogle = "google"
+	SourceCSV    = "csv"
+	SourceXLSX   = "xlsx"
+)
 
-// parse the orkfile and populate the task inventory
-func ParseConfig(contents []byte) (*Config, error) {
-	p := &Config{}
-	if err := yaml.Unmarshal(contents, p); err != nil {
-		return nil, err
+const (
+	SheetTypeNormal   = "normal"
+	SheetTypePriority = "priority"
+)
+
+// CredentialsKey identifies the sheet's own credentials (if any)
+func (s *Sheet) CredentialsKey() string {
+	if s.Credentials != "" {
+		return s.Credentials
 	}
-	return p, nil
+	if s.CredentialsFile != "" {
+		return "file:" + s.CredentialsFile
+	}
+	return ""
 }
 
-type Payment struct {
-	description string
-	due         time.Time
+func (s *Sheet) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
 }
 
-func NewPayment(description string) *Payment {
-	return &Payment{description: description}
+// EnabledSheets drops (and logs to logger) the disabled sheets
+func EnabledSheets(sheets []*Sheet, logger *log.Logger) []*Sheet {
+	enabled := []*Sheet{}
+	for _, sheet := range sheets {
+		if !sheet.IsEnabled() {
+			logger.Printf("skipping disabled sheet %s", sheet.Name)
+			continue
+		}
+		enabled = append(enabled, sheet)
+	}
+	return enabled
 }
 
-func (p *Payment) WithDueDate(due time.Time) *Payment {
-	p.due = ToDate(due.In(GreekTimeZone()))
-	return p
-}
+// DefaultPaymentDateColumn is the label of the payment date column
+const DefaultPaymentDateColumn = "Payment Date"
 
-func (p *Payment) IsDue() bool {
-	return p.due != time.Time{}
+// PaymentDateLabel is the label of the sheet's payment date column
+func (s *Sheet) PaymentDateLabel() string {
+	if s.PaymentDateColumn == "" {
+		return DefaultPaymentDateColumn
+	}
+	return s.PaymentDateColumn
 }
 
-func (p *Payment) DiffFromNowInDays(now time.Time) int {
-	now = ToDate(now.In(GreekTimeZone()))
-	d := p.due.Sub(now).Hours() / 24
-	return int(d)
+// Location identifies the spreadsheet (or the file) that contains the sheet
+func (s *Sheet) Location() string {
+	if s.Source == SourceCSV || s.Source == SourceXLSX {
+		return s.Path
+	}
+	return s.SpreadsheetId
 }
 
-func run(config *Config, jwtcfg *jwt.Config, print bool) error {
-	client := jwtcfg.Client(oauth2.NoContext)
-	svc, err := sheets.NewService(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return fmt.Errorf("Unable to retrieve Sheets Client: %v", err)
-	}
+// AllSheets is the sheet name that expands to all tabs of a spreadsheet
+const AllSheets = "*"
 
-	payments := []*Payment{}
+type Config struct {
+	NotificationTopic string    `yaml:"ntfy_topic"`
+	CronSchedule      Schedules `yaml:"cron_schedule"`
+	Credentials       string    `yaml:"credentials"`
+	Sheets            []*Sheet  `yaml:"sheets"`
+	// failed runs are reported to this topic (if set)
+	ErrorTopic string `yaml:"error_topic"`
+	// payments below this amount are left out of the delayed/today/coming up
+	// summaries (payments with no amount are always reported)
+	MinAmount float64 `yaml:"min_amount"`
+	// the report sections (and their order) to include in the report
+	SectionOrder []string `yaml:"section_order"`
+	// the layout used for rendering dates in the report
+	DisplayDateFormat string `yaml:"display_date_format"`
+	// daily (default) or weekly (a digest of the next 7 days)
+	ReportMode string `yaml:"report_mode"`
+	// the maximum number of attempts for reading a spreadsheet
+	SheetReadAttempts int `yaml:"sheet_read_attempts"`
+	// group the payments of each section by category
+	GroupByCategory bool `yaml:"group_by_category"`
+	// delay each scheduled run by a random duration up to this value
+	ScheduleJitter time.Duration `yaml:"schedule_jitter"`
+	// truncate the report (at a section boundary) beyond this size
+	MaxReportBytes int `yaml:"max_report_bytes"`
+	// the ntfy tags of reports with payments that are delayed or due by
+	// tomorrow (urgent) and of all other reports (neutral)
+	UrgentTag  string `yaml:"urgent_tag"`
+	NeutralTag string `yaml:"neutral_tag"`
+	// toggles for the individual report sections (all enabled by default)
+	ShowDelayed  *bool `yaml:"show_delayed"`
+	ShowToday    *bool `yaml:"show_today"`
+	ShowComingUp *bool `yaml:"show_coming_up"`
+	ShowTotal    *bool `yaml:"show_total"`
+	ShowUndated  *bool `yaml:"show_undated"`
+	// stop reporting a payment after it has been reported as due this many
+	// times (counts are kept in the state file)
+	MaxReminders int    `yaml:"max_reminders"`
+	StateFile    string `yaml:"state_file"`
+	// reports are paused until the date (YYYY-MM-DD) found in this file
+	// (or in the PAUSE_UNTIL env var)
+	PauseFile string `yaml:"pause_file"`
+	// list at most this many payments in each section (0 for unlimited)
+	MaxPerSection int `yaml:"max_per_section"`
+	// the url opened by clicking the notification (e.g. the spreadsheet)
+	// and whether to also add a "View Sheet" button for it
+	ClickURL   string `yaml:"ntfy_click_url"`
+	ViewButton bool   `yaml:"ntfy_view_button"`
+	// forward reports of at least this (overdue) priority (default: 5)
+	// to the email address and/or phone number (ntfy's Email/Call headers)
+	ForwardEmail       string `yaml:"ntfy_email"`
+	ForwardCall        string `yaml:"ntfy_call"`
+	ForwardMinPriority int    `yaml:"ntfy_forward_min_priority"`
+	// the priority of all reports (1-5, unset for ntfy's default) unless
+	// their overdue payments call for a higher one
+	NtfyPriority int `yaml:"ntfy_priority"`
+	// attach all the payments (with their amounts and sheets) to the
+	// report as a csv file
+	AttachDetails bool `yaml:"attach_details"`
+	// the "this month" section lists the payments due after the coming up
+	// ones and within this many days (0 for the end of the month)
+	ThisMonthDays int `yaml:"this_month_days"`
+	// note sheets whose newest (unpaid) due date is older than this many
+	// days as possibly stale (0 to disable)
+	StaleAfterDays int `yaml:"stale_after_days"`
+	// the proxy of all outbound requests (overrides HTTPS_PROXY/HTTP_PROXY)
+	HTTPProxy string `yaml:"http_proxy"`
+	// the User-Agent of all outbound requests (default: remindme/<version>)
+	UserAgent string `yaml:"user_agent"`
+	// list the payments that became delayed, were paid or were added since
+	// the last run (the pending payments are kept in the state file)
+	ShowChanges bool `yaml:"show_changes"`
+	// the label of the coming up section (default: Coming Up)
+	ComingUpLabel string `yaml:"coming_up_label"`
+	// the decimal separator of amounts ("." or ",") -- the other one is
+	// taken to be the thousands separator
+	DecimalSeparator string `yaml:"decimal_separator"`
+	// add the id of the run to the notification's tags (the id is always
+	// included in the run's log lines)
+	ShowRunID bool `yaml:"show_run_id"`
+	// payments overdue for more than this many days are only counted (and
+	// not listed) in the delayed section (0 to list all)
+	MaxOverdueDays int `yaml:"max_overdue_days"`
+	// the horizon (in days) of the total section (default: 30)
+	TotalWindowDays int `yaml:"total_window_days"`
+	// the public url of this instance (in cron mode) and the shared secret
+	// used for signing the "paid" action buttons of due google payments
+	CallbackURL    string `yaml:"callback_url"`
+	CallbackSecret string `yaml:"callback_secret"`
+	// enables POST /run (in cron mode) which runs the report on demand for
+	// requests with this secret as their bearer token
+	RunSecret string `yaml:"run_secret"`
+	// matches of this regular expression are removed from the descriptions
+	// (e.g. bookkeeping codes like "[ACC-123]")
+	DescriptionStrip string `yaml:"description_strip"`
+	// add a footer with the number of payments read from each sheet
+	ShowSources bool `yaml:"show_sources"`
+	// add a footer with links to the (google) spreadsheets of the reported
+	// payments
+	ShowSheetLinks bool `yaml:"show_sheet_links"`
+	// add a footer with the payments paid within this many days (according
+	// to their payment date) -- 0 to disable
+	RecapDays int `yaml:"recap_days"`
+	// payments are listed as coming up at most this many days before they
+	// are due unless they specify their own Lead Days (0 for no limit)
+	ComingUpDays int `yaml:"coming_up_days"`
+	// send each section with something to report as a separate notification
+	SplitNotifications bool `yaml:"split_notifications"`
+	// cron schedules start with a seconds field (default: the standard
+	// 5-field crontab format)
+	CronWithSeconds bool `yaml:"cron_with_seconds"`
+	// payments whose description starts with this marker (e.g. "✅") are
+	// skipped as if they were paid
+	AckPrefix string `yaml:"ack_prefix"`
+	// compare the total amount due within the total window to this budget
+	// (prorated from a 30-day month) -- 0 to disable
+	MonthlyBudget float64 `yaml:"monthly_budget"`
+	// reports are built (and logged) but not sent on weekends and on these
+	// dates (YYYY-MM-DD) in athens time
+	SkipWeekends bool     `yaml:"skip_weekends"`
+	SkipDates    []string `yaml:"skip_dates"`
+	// payments due today with a due time at most this many hours away are
+	// listed in the "due soon" section (default: 3)
+	DueSoonHours int `yaml:"due_soon_hours"`
+	// do not send reports with nothing to report (apart from the total)
+	SuppressEmpty bool `yaml:"suppress_empty"`
+	// reports of runs between these times (HH:MM in athens time) are
+	// deferred until the end of the quiet hours or skipped (depending on
+	// the mode)
+	QuietHoursStart string `yaml:"quiet_hours_start"`
+	QuietHoursEnd   string `yaml:"quiet_hours_end"`
+	QuietHoursMode  string `yaml:"quiet_hours_mode"`
+	// report each payment once a day (unless it becomes more urgent, e.g.
+	// delayed) when running more than once a day
+	NotifyOncePerDay bool `yaml:"notify_once_per_day"`
+	// count only business days (i.e. weekdays that are not one of the
+	// holidays) in the coming up window and the lead days of payments
+	BusinessDays bool     `yaml:"business_days"`
+	Holidays     []string `yaml:"holidays"`
+	// list the delayed payments (marked as overdue) in the today section
+	// instead of their own section
+	MergeDelayedIntoToday bool `yaml:"merge_delayed_into_today"`
+	// fail reading sheets with duplicate header labels (instead of logging
+	// a warning and using the first column of each label)
+	StrictHeaders bool `yaml:"strict_headers"`
+	// (in cron mode) only send the scheduled reports that this instance
+	// takes the lock of -- a path on storage shared by all instances (see
+	// RunLock)
+	LockFile string `yaml:"lock_file"`
+	// the order of the payments of each section: date (default, most
+	// urgent first) or amount (largest first)
+	SortBy string `yaml:"sort_by"`
+	// also run the report when the (google) spreadsheets change (using
+	// drive notifications sent to the callback_url) on top of the schedule
+	WatchChanges bool `yaml:"watch_changes"`
+	// render the report using this go text/template (inline or from a
+	// file) instead of the default format
+	ReportTemplate     string `yaml:"report_template"`
+	ReportTemplateFile string `yaml:"report_template_file"`
+	// the parsed report template (if any)
+	reportTemplate *template.Template
+}
 
-	for _, sheet := range config.Sheets {
-		rows, err := getSheet(svc, sheet.SpreadsheetId, sheet.Name)
-		if err != nil {
-			return fmt.Errorf("failed to read sheet %s: %v", sheet.Name, err)
-		}
-		p, err := readPayments(rows)
-		if err != nil {
-			return fmt.Errorf("failed to read payments from sheet '%s': %v", sheet.Name, err)
-		}
-		payments = append(payments, p...)
-	}
+// Schedules are one or more cron expressions (given as a single string or
+// as a list)
+type Schedules []string
 
-	// formulate payment report
-	sections := []string{}
-	if summary := SummarizePaymentsForToday(payments); summary != "" {
-		sections = append(sections, summary)
+func (s *Schedules) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = Schedules{value.Value}
+		return nil
 	}
-	if summary := SummarizeDelayedPayments(payments); summary != "" {
-		sections = append(sections, summary)
-	}
-	if summary := SummarizePaymentsComingUp(payments); summary != "" {
-		sections = append(sections, summary)
-	}
-	if summary := SummarizeTotalPayments(payments, 30); summary != "" {
-		sections = append(sections, summary)
-	}
-	if len(sections) == 0 {
-		sections = append(sections, "🕶  Nothing to report")
+	var schedules []string
+	if err := value.Decode(&schedules); err != nil {
+		return err
 	}
+	*s = schedules
+	return nil
+}
 
-	// format and send report
-	report := strings.Join(sections, "\n")
+func (s Schedules) MarshalYAML() (interface{}, error) {
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	return []string(s), nil
+}
 
-	if print {
-		fmt.Print(report)
+// CronParser returns the parser of the cron schedules (with or without a
+// seconds field)
+func (c *Config) CronParser() cron.Parser {
+	fields := cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor
+	if c.CronWithSeconds {
+		fields |= cron.Second
 	}
+	return cron.NewParser(fields)
+}
 
-	if err := SendNotification(config.NotificationTopic, "Payment Report", report, ""); err != nil {
-		return fmt.Errorf("failed to send notification: %v", err)
+// CronFormat describes the format of the cron schedules
+func (c *Config) CronFormat() string {
+	if c.CronWithSeconds {
+		return "6-field with seconds"
 	}
-	return nil
+	return "5-field"
 }
 
-func main() {
-	var (
-		print    bool
-		cronMode bool
-	)
-	flag.BoolVar(&print, "print", false, "Print the report on screen as well")
-	flag.BoolVar(&cronMode, "cron", true, "Enable/disable cron mode")
-	flag.Parse()
+const (
+	SectionPriority  = "priority"
+	SectionDueSoon   = "due_soon"
+	SectionToday     = "today"
+	SectionDelayed   = "delayed"
+	SectionComingUp  = "coming_up"
+	SectionThisMonth = "this_month"
+	SectionUndated   = "undated"
+	SectionOptional  = "optional"
+	SectionTotal     = "total"
+)
 
-	log.Printf("cron_mode=%v", cronMode)
+var DefaultSectionOrder = []string{SectionPriority, SectionDueSoon, SectionToday, SectionDelayed, SectionComingUp, SectionThisMonth, SectionUndated, SectionOptional, SectionTotal}
 
-	config, err := ParseConfig([]byte(configFileContents))
-	if err != nil {
-		log.Fatalf("Unable to parse config file: %v", err)
-	}
+const DefaultDisplayDateFormat = time.DateOnly
 
-	log.Printf("Found %d sheets", len(config.Sheets))
+const (
+	ReportModeDaily  = "daily"
+	ReportModeWeekly = "weekly"
+)
 
-	jwtcfg, err := google.JWTConfigFromJSON([]byte(config.Credentials), sheets.SpreadsheetsScope)
-	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
-	}
+const (
+	SortByDate   = "date"
+	SortByAmount = "amount"
+)
 
-	if cronMode {
-		c := cron.New(cron.WithLocation(GreekTimeZone()))
-		_, err := c.AddFunc(config.CronSchedule, func() {
-			if err := run(config, jwtcfg, print); err != nil {
-				log.Printf(err.Error())
-			}
-		})
+const DefaultSheetReadAttempts = 3
 
-		if err != nil {
-			log.Fatalf("failed to setup cron: %v", err)
-		}
+const DefaultUrgentTag = "warning"
 
-		c.Start()
+const DefaultStateFile = "remindme.state.json"
 
-		log.Printf("started cron with schedule='%s'", config.CronSchedule)
+const DefaultComingUpLabel = "Coming Up"
 
-		select {}
-	} else {
-		if err := run(config, jwtcfg, print); err != nil {
-			log.Printf(err.Error())
+const DefaultDueSoonHours = 3
+
+const DefaultPaidStatus = "Paid"
+
+const DefaultDecimalSeparator = "."
+
+const DefaultTotalWindowDays = 30
+
+const (
+	ConfigFormatYAML = "yaml"
+	ConfigFormatJSON = "json"
+	ConfigFormatTOML = "toml"
+)
+
+// parse the orkfile and populate the task inventory
+func ParseConfig(contents []byte) (*Config, error) {
+	p := &Config{}
+	if err := yaml.Unmarshal(contents, p); err != nil {
+		return nil, err
+	}
+	if err := p.expandEnv(); err != nil {
+		return nil, err
+	}
+	if err := p.applyEnvOverrides(); err != nil {
+		return nil, err
+	}
+	if len(p.SectionOrder) == 0 {
+		p.SectionOrder = DefaultSectionOrder
+	}
+	if p.DisplayDateFormat == "" {
+		p.DisplayDateFormat = DefaultDisplayDateFormat
+	}
+	if p.ReportMode == "" {
+		p.ReportMode = ReportModeDaily
+	}
+	if p.SortBy == "" {
+		p.SortBy = SortByDate
+	}
+	if p.SheetReadAttempts == 0 {
+		p.SheetReadAttempts = DefaultSheetReadAttempts
+	}
+	if p.DecimalSeparator == "" {
+		p.DecimalSeparator = DefaultDecimalSeparator
+	}
+	for _, sheet := range p.Sheets {
+		if sheet.DecimalSeparator == "" {
+			sheet.DecimalSeparator = p.DecimalSeparator
+		}
+		if sheet.Source == "" {
+			sheet.Source = SourceGoogle
+		}
+		if sheet.Type == "" {
+			sheet.Type = SheetTypeNormal
+		}
+		sheet.ackPrefix = p.AckPrefix
+		sheet.strictHeaders = p.StrictHeaders
+		if sheet.StatusColumn != "" && len(sheet.PaidStatuses) == 0 {
+			sheet.PaidStatuses = []string{DefaultPaidStatus}
+		}
+	}
+	if p.UrgentTag == "" {
+		p.UrgentTag = DefaultUrgentTag
+	}
+	if p.StateFile == "" {
+		p.StateFile = DefaultStateFile
+	}
+	if p.PauseFile == "" {
+		p.PauseFile = DefaultPauseFile
+	}
+	if p.TotalWindowDays == 0 {
+		p.TotalWindowDays = DefaultTotalWindowDays
+	}
+	if p.ForwardMinPriority == 0 {
+		p.ForwardMinPriority = PriorityUrgent
+	}
+	if p.UserAgent == "" {
+		p.UserAgent = DefaultUserAgent()
+	}
+	if p.QuietHoursMode == "" {
+		p.QuietHoursMode = QuietHoursDefer
+	}
+	if p.DueSoonHours == 0 {
+		p.DueSoonHours = DefaultDueSoonHours
+	}
+	if p.ComingUpLabel == "" {
+		p.ComingUpLabel = DefaultComingUpLabel
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if err := p.loadReportTemplate(); err != nil {
+		return nil, err
+	}
+	if p.DescriptionStrip != "" {
+		strip := regexp.MustCompile(p.DescriptionStrip)
+		for _, sheet := range p.Sheets {
+			sheet.descriptionStrip = strip
 		}
 	}
+	return p, nil
+}
+
+// LoadConfig parses the config file at path in the given format (or the
+// one implied by its extension)
+func LoadConfig(path, format string) (*Config, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = ConfigFormatFromPath(path)
+	}
+	return ParseConfigAs(contents, format)
 }
 
-func SummarizeDelayedPayments(payments []*Payment) string {
-	delayed := FindPaymentsUntil(payments, -1, time.Now())
+// ConfigFormatFromPath detects the config format from the file extension
+func ConfigFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ConfigFormatJSON
+	case ".toml":
+		return ConfigFormatTOML
+	}
+	return ConfigFormatYAML
+}
 
-	if len(delayed) > 0 {
-		message := fmt.Sprintf("⚠ Delayed: ")
-		descriptions := []string{}
-		for _, p := range delayed {
-			descriptions = append(descriptions, p.description)
+// ParseConfigAs parses the config contents in the given format; json and
+// toml configs are converted to yaml so that the yaml field tags apply
+func ParseConfigAs(contents []byte, format string) (*Config, error) {
+	values := map[string]interface{}{}
+	switch format {
+	case ConfigFormatYAML:
+		return ParseConfig(contents)
+	case ConfigFormatJSON:
+		if err := json.Unmarshal(contents, &values); err != nil {
+			return nil, err
+		}
+	case ConfigFormatTOML:
+		if err := toml.Unmarshal(contents, &values); err != nil {
+			return nil, err
 		}
-		return message + strings.Join(descriptions, ", ")
+	default:
+		return nil, fmt.Errorf("unknown config format '%s'", format)
 	}
-	return ""
+	contents, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(contents)
 }
 
-func SummarizePaymentsForToday(payments []*Payment) string {
-	scheduled := FindPaymentsAt(payments, 0, time.Now())
-
-	if len(scheduled) > 0 {
-		message := fmt.Sprintf("💸 Today: ")
-		descriptions := []string{}
-		for _, p := range scheduled {
-			descriptions = append(descriptions, p.description)
+// expandEnv substitutes ${VAR} references in the config's string fields
+// with the values of the corresponding environment variables
+func (c *Config) expandEnv() error {
+	fields := []*string{&c.NotificationTopic, &c.ErrorTopic, &c.Credentials, &c.CallbackURL, &c.CallbackSecret, &c.RunSecret}
+	for i := range c.CronSchedule {
+		fields = append(fields, &c.CronSchedule[i])
+	}
+	for _, sheet := range c.Sheets {
+		fields = append(fields, &sheet.SpreadsheetId, &sheet.Name, &sheet.Credentials)
+	}
+	for _, field := range fields {
+		value, err := expandEnv(*field)
+		if err != nil {
+			return err
 		}
-		return message + strings.Join(descriptions, ", ")
+		*field = value
 	}
-	return "😎 Nothing for today"
+	return nil
 }
 
-func SummarizePaymentsComingUp(payments []*Payment) string {
-	futurePayments := []*Payment{}
-	now := time.Now()
+// the environment variables that override the corresponding settings
+const (
+	CronScheduleEnv    = "CRON_SCHEDULE"
+	NtfyTopicEnv       = "NTFY_TOPIC"
+	ErrorTopicEnv      = "ERROR_TOPIC"
+	StateFileEnv       = "STATE_FILE"
+	ComingUpDaysEnv    = "COMING_UP_DAYS"
+	TotalWindowDaysEnv = "TOTAL_WINDOW_DAYS"
+)
 
-	for _, p := range payments {
-		if p.due.IsZero() {
-			continue
+// applyEnvOverrides replaces the most commonly tuned settings with the
+// values of the corresponding environment variables (when set to a
+// non-empty value); CRON_SCHEDULE may list multiple schedules separated
+// by ";"
+func (c *Config) applyEnvOverrides() error {
+	if value := os.Getenv(CronScheduleEnv); value != "" {
+		schedules := Schedules{}
+		for _, schedule := range strings.Split(value, ";") {
+			if schedule = strings.TrimSpace(schedule); schedule != "" {
+				schedules = append(schedules, schedule)
+			}
 		}
-		if p.DiffFromNowInDays(now) > 0 {
-			futurePayments = append(futurePayments, p)
+		c.CronSchedule = schedules
+	}
+	fields := map[string]*string{
+		NtfyTopicEnv:  &c.NotificationTopic,
+		ErrorTopicEnv: &c.ErrorTopic,
+		StateFileEnv:  &c.StateFile,
+	}
+	for name, field := range fields {
+		if value := os.Getenv(name); value != "" {
+			*field = value
 		}
 	}
-
-	sort.Slice(futurePayments, func(i, j int) bool {
-		return futurePayments[i].due.Before(futurePayments[j].due)
-	})
-
-	if len(futurePayments) == 0 {
-		return fmt.Sprint("😎 Nothing coming up")
+	days := map[string]*int{
+		ComingUpDaysEnv:    &c.ComingUpDays,
+		TotalWindowDaysEnv: &c.TotalWindowDays,
 	}
+	for name, field := range days {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = n
+		}
+	}
+	return nil
+}
 
-	// figure out next payment due date and corresponding payments
-	nextTs := time.Time{}
-	comingUp := []*Payment{}
+// envReference matches the ${VAR} references of config values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
 
-	for _, p := range futurePayments {
-		if nextTs.IsZero() {
-			nextTs = p.due
-			comingUp = append(comingUp, p)
-		} else if p.DiffFromNowInDays(nextTs) == 0 {
-			comingUp = append(comingUp, p)
+// expandEnv replaces the ${VAR} references of s with the values of the
+// environment variables; other uses of $ (e.g. in secrets or sheet names)
+// are kept as they are
+func expandEnv(s string) (string, error) {
+	missing := []string{}
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
 		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable(s) not set: %s", strings.Join(missing, ", "))
 	}
+	return expanded, nil
+}
 
-	message := fmt.Sprintf("⏳ Coming Up (%s): ", nextTs.Format("2006-01-02"))
-	descriptions := []string{}
-	for _, p := range comingUp {
-		descriptions = append(descriptions, fmt.Sprintf("%s", p.description))
+// HasSection reports whether the section is included in the report
+func (c *Config) HasSection(key string) bool {
+	for _, section := range c.SectionOrder {
+		if section == key {
+			return c.IsSectionEnabled(key)
+		}
 	}
-	return message + strings.Join(descriptions, ", ")
+	return false
 }
 
-func SummarizeTotalPayments(payments []*Payment, timeWindowInDays int) string {
-	n := 0
-	for _, p := range payments {
-		if p.DiffFromNowInDays(time.Now()) <= timeWindowInDays {
-			n += 1
-		}
+// IsSectionEnabled is false for the sections that are turned off using
+// the corresponding show_* flag
+func (c *Config) IsSectionEnabled(key string) bool {
+	toggles := map[string]*bool{
+		SectionDelayed:  c.ShowDelayed,
+		SectionToday:    c.ShowToday,
+		SectionComingUp: c.ShowComingUp,
+		SectionTotal:    c.ShowTotal,
+		SectionUndated:  c.ShowUndated,
 	}
-	return fmt.Sprintf("💰 Total %d payments pending during the next %d days", n, timeWindowInDays)
+	show, ok := toggles[key]
+	return !ok || show == nil || *show
 }
 
-func FindPaymentsAt(payments []*Payment, diff int, now time.Time) []*Payment {
-	found := []*Payment{}
-	for _, p := range payments {
-		// skip non-due payments
-		if !p.IsDue() {
-			continue
-		}
-		if p.DiffFromNowInDays(now) == diff {
-			found = append(found, p)
+// IsSkipDay reports whether no reports are sent on the day of now (in
+// athens time)
+func (c *Config) IsSkipDay(now time.Time) bool {
+	now = now.In(GreekTimeZone())
+	if c.SkipWeekends && (now.Weekday() == time.Saturday || now.Weekday() == time.Sunday) {
+		return true
+	}
+	today := now.Format(time.DateOnly)
+	for _, date := range c.SkipDates {
+		if date == today {
+			return true
 		}
 	}
-	return found
+	return false
 }
 
-func FindPaymentsUntil(payments []*Payment, maxDiff int, now time.Time) []*Payment {
-	delayed := []*Payment{}
-	for _, p := range payments {
-		// skip non-due payments
-		if !p.IsDue() {
-			continue
-		}
-		if p.DiffFromNowInDays(now) <= maxDiff {
-			delayed = append(delayed, p)
+// HasSource is true if any of the sheets is read from the given source
+func (c *Config) HasSource(source string) bool {
+	for _, sheet := range c.Sheets {
+		if sheet.Source == source {
+			return true
 		}
 	}
-	return delayed
+	return false
 }
 
-func getSheet(svc *sheets.Service, spreadsheetId, sheetName string) ([][]interface{}, error) {
-	res, err := svc.Spreadsheets.Values.Get(spreadsheetId, sheetName).Do()
-	if err != nil {
-		return nil, err
+// Redacted returns a copy of the config with its secrets redacted
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.Credentials != "" {
+		redacted.Credentials = "<redacted>"
 	}
-	rows := res.Values
-	if len(rows) <= 1 {
-		return nil, errors.New("no data found")
+	if redacted.CallbackSecret != "" {
+		redacted.CallbackSecret = "<redacted>"
 	}
-	return rows, nil
-
-}
-
-func readPayments(rows [][]interface{}) ([]*Payment, error) {
-	descriptionIndex := -1
-	dueDateIndex := -1
-	paymentDateIndex := -1
-	for idx, v := range rows[0] {
-		val := v.(string)
-		if val == "Description" {
-			descriptionIndex = idx
-		}
-		if val == "Due Date" {
-			dueDateIndex = idx
-		}
-		if val == "Payment Date" {
-			paymentDateIndex = idx
-		}
+	if redacted.RunSecret != "" {
+		redacted.RunSecret = "<redacted>"
 	}
-	if descriptionIndex == -1 {
-		return nil, errors.New("description label was not found in sheet header")
+	// anyone who knows a topic can read (and publish to) it
+	if redacted.NotificationTopic != "" {
+		redacted.NotificationTopic = "<redacted>"
 	}
-	if paymentDateIndex == -1 {
-		return nil, errors.New("payment date was not found in sheet header")
+	if redacted.ErrorTopic != "" {
+		redacted.ErrorTopic = "<redacted>"
 	}
-
-	payments := []*Payment{}
-	var (
-		err     error
-		due     time.Time
-		dueDate string
-	)
-
-	for idx, row := range rows[1:] {
-		if descriptionIndex > len(row)-1 {
-			// this means that there is no description
-			// we will consider the row as being empty and skip it
-			continue
-		}
-
-		description := row[descriptionIndex].(string)
-
-		if dueDateIndex > len(row)-1 {
-			return nil, fmt.Errorf("can not read due date for %s (column=%d) in row %d", description, dueDateIndex, idx)
+	if redacted.ForwardEmail != "" {
+		redacted.ForwardEmail = "<redacted>"
+	}
+	if redacted.ForwardCall != "" {
+		redacted.ForwardCall = "<redacted>"
+	}
+	// only the credentials of the proxy are redacted
+	if redacted.HTTPProxy != "" {
+		if u, err := url.Parse(redacted.HTTPProxy); err != nil {
+			redacted.HTTPProxy = "<redacted>"
+		} else if u.User != nil {
+			u.User = url.UserPassword("REDACTED", "REDACTED")
+			redacted.HTTPProxy = u.String()
 		}
-		if paymentDateIndex > len(row)-1 {
-			return nil, fmt.Errorf("can not read payment date for %s (column=%d) in row %d", description, paymentDateIndex, idx)
+	}
+	redacted.Sheets = []*Sheet{}
+	for _, sheet := range c.Sheets {
+		s := *sheet
+		if s.Credentials != "" {
+			s.Credentials = "<redacted>"
 		}
+		redacted.Sheets = append(redacted.Sheets, &s)
+	}
+	return &redacted
+}
 
-		if dueDateIndex >= 0 {
-			dueDate = row[dueDateIndex].(string)
-		}
-		paymentDate := row[paymentDateIndex].(string)
-		if paymentDate != "" {
-			// already paid -- skip
-			continue
-		}
-		if dueDateIndex == -1 {
-			// not a scheduled payment -- add to payments and continue
-			payments = append(payments, NewPayment(description))
-			continue
+func (c *Config) Validate() error {
+	for _, key := range c.SectionOrder {
+		if !isValidSection(key) {
+			return fmt.Errorf("unknown section '%s' in section_order", key)
 		}
-		// scheduled payment -- parse due date
-		if due, err = time.Parse(time.DateOnly, dueDate); err != nil {
-			return nil, fmt.Errorf("failed to parse due date value %s: %v", dueDate, err)
+	}
+	// a layout without any date elements is formatted verbatim
+	sample := time.Date(2023, time.November, 24, 0, 0, 0, 0, time.UTC)
+	if sample.Format(c.DisplayDateFormat) == c.DisplayDateFormat {
+		return fmt.Errorf("invalid display_date_format '%s'", c.DisplayDateFormat)
+	}
+	if c.ReportMode != ReportModeDaily && c.ReportMode != ReportModeWeekly {
+		return fmt.Errorf("unknown report_mode '%s'", c.ReportMode)
+	}
+	if c.SortBy != SortByDate && c.SortBy != SortByAmount {
+		return fmt.Errorf("unknown sort_by '%s'", c.SortBy)
+	}
+	if c.SheetReadAttempts < 1 {
+		return errors.New("sheet_read_attempts must be positive")
+	}
+	for _, schedule := range c.CronSchedule {
+		if _, err := c.CronParser().Parse(schedule); err != nil {
+			return fmt.Errorf("invalid cron_schedule '%s' (expected the %s format): %v", schedule, c.CronFormat(), err)
 		}
-		payments = append(payments, NewPayment(description).WithDueDate(due))
 	}
-	return payments, nil
-}
-
-func SendNotification(topic, title, message, tag string) error {
-	host := fmt.Sprintf("https://ntfy.sh/%s", topic)
-	req, err := http.NewRequest(http.MethodPost, host, strings.NewReader(message))
-	if err != nil {
-		return fmt.Errorf("failed to create http request: %v", err)
+	if c.ScheduleJitter < 0 {
+		return errors.New("schedule_jitter can not be negative")
 	}
-	req.Header.Set("Title", title)
-	req.Header.Set("Tags", tag)
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending http request: %v", err)
+	if c.MaxReportBytes < 0 {
+		return errors.New("max_report_bytes can not be negative")
 	}
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server responded with status=%d", res.StatusCode)
+	if c.MaxReminders < 0 {
+		return errors.New("max_reminders can not be negative")
+	}
+	if c.MaxPerSection < 0 {
+		return errors.New("max_per_section can not be negative")
+	}
+	if c.ThisMonthDays < 0 {
+		return errors.New("this_month_days can not be negative")
+	}
+	if c.NtfyPriority < 0 || c.NtfyPriority > PriorityUrgent {
+		return fmt.Errorf("ntfy_priority must be between 1 and %d", PriorityUrgent)
+	}
+	if c.ForwardMinPriority < 1 || c.ForwardMinPriority > PriorityUrgent {
+		return fmt.Errorf("ntfy_forward_min_priority must be between 1 and %d", PriorityUrgent)
+	}
+	if (c.CallbackURL == "") != (c.CallbackSecret == "") {
+		return errors.New("callback_url and callback_secret need to be set together")
+	}
+	if c.ReportTemplate != "" && c.ReportTemplateFile != "" {
+		return errors.New("only one of report_template and report_template_file can be set")
+	}
+	if c.WatchChanges && c.CallbackURL == "" {
+		return errors.New("watch_changes requires callback_url and callback_secret")
+	}
+	if _, err := regexp.Compile(c.DescriptionStrip); err != nil {
+		return fmt.Errorf("invalid description_strip: %v", err)
+	}
+	if err := c.validateQuietHours(); err != nil {
+		return err
+	}
+	if c.DueSoonHours < 0 {
+		return errors.New("due_soon_hours can not be negative")
+	}
+	if c.ComingUpDays < 0 {
+		return errors.New("coming_up_days can not be negative")
+	}
+	// the coming up section starts from tomorrow (and spans coming_up_days
+	// if set) so the total needs to look further than that
+	if c.TotalWindowDays < 2 {
+		return errors.New("total_window_days must be greater than 1 (the coming up section starts from tomorrow)")
+	}
+	if c.ComingUpDays > 0 && c.TotalWindowDays <= c.ComingUpDays {
+		return fmt.Errorf("total_window_days must be greater than coming_up_days (%d)", c.ComingUpDays)
+	}
+	for _, date := range c.SkipDates {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("invalid skip_dates date '%s' (expected YYYY-MM-DD)", date)
+		}
+	}
+	for _, date := range c.Holidays {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("invalid holidays date '%s' (expected YYYY-MM-DD)", date)
+		}
+	}
+	if c.MonthlyBudget < 0 {
+		return errors.New("monthly_budget can not be negative")
+	}
+	if c.MaxOverdueDays < 0 {
+		return errors.New("max_overdue_days can not be negative")
+	}
+	if c.StaleAfterDays < 0 {
+		return errors.New("stale_after_days can not be negative")
+	}
+	if c.RecapDays < 0 {
+		return errors.New("recap_days can not be negative")
+	}
+	if c.DecimalSeparator != "." && c.DecimalSeparator != "," {
+		return fmt.Errorf("invalid decimal_separator '%s'", c.DecimalSeparator)
+	}
+	if c.HTTPProxy != "" {
+		if u, err := url.Parse(c.HTTPProxy); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid http_proxy '%s'", c.HTTPProxy)
+		}
+	}
+	for _, sheet := range c.Sheets {
+		if _, err := path.Match(sheet.Exclude, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern '%s' for sheet %s: %v", sheet.Exclude, sheet.Name, err)
+		}
+		if sheet.NetDays < 0 {
+			return fmt.Errorf("net_days can not be negative for sheet %s", sheet.Name)
+		}
+		if sheet.Type != SheetTypeNormal && sheet.Type != SheetTypePriority {
+			return fmt.Errorf("unknown type '%s' for sheet %s", sheet.Type, sheet.Name)
+		}
+		if sheet.HeaderRow < 0 {
+			return fmt.Errorf("header_row can not be negative for sheet %s", sheet.Name)
+		}
+		if sheet.StatusColumn == "" && (len(sheet.PaidStatuses) > 0 || len(sheet.SkipStatuses) > 0) {
+			return fmt.Errorf("paid_statuses and skip_statuses require a status_column for sheet %s", sheet.Name)
+		}
+		if sheet.DecimalSeparator != "." && sheet.DecimalSeparator != "," {
+			return fmt.Errorf("invalid decimal_separator '%s' for sheet %s", sheet.DecimalSeparator, sheet.Name)
+		}
+		switch sheet.Source {
+		case SourceGoogle:
+		case SourceCSV, SourceXLSX:
+			if sheet.Path == "" {
+				return fmt.Errorf("path is required for %s sheet %s", sheet.Source, sheet.Name)
+			}
+		default:
+			return fmt.Errorf("unknown source '%s' for sheet %s", sheet.Source, sheet.Name)
+		}
+	}
+	return nil
+}
+
+func isValidSection(key string) bool {
+	for _, section := range DefaultSectionOrder {
+		if key == section {
+			return true
+		}
+	}
+	return false
+}
+
+type Payment struct {
+	description string
+	due         time.Time
+	hasDueDate  bool
+	amount      float64
+	hasAmount   bool
+	currency    string
+	// optional payments are informational reminders and not obligations
+	optional bool
+	// priority payments are always reported
+	priority bool
+	category string
+	// hashtags found in the description (without the #)
+	tags []string
+	// the cutoff time on the due date (if the sheet specifies one)
+	dueTime    time.Time
+	hasDueTime bool
+	// where the payment date is written when paid (google sheets only)
+	paidCell *PaidCell
+	// how many days before its due date the payment is coming up
+	leadDays    int
+	hasLeadDays bool
+	// the description as found in the sheet (before description_strip)
+	original string
+	// muted payments (see max_reminders) are left out of the sections
+	muted bool
+	// the date the payment was paid on (zero if it is pending or its
+	// payment date could not be parsed)
+	paidOn time.Time
+	// the name of the sheet the payment was read from and its spreadsheet
+	// (for google sheets)
+	sheet         string
+	spreadsheetId string
+}
+
+func NewPayment(description string) *Payment {
+	return &Payment{description: description, original: description}
+}
+
+// WithDisplayDescription replaces the displayed description while keeping
+// the original one for identifying the payment
+func (p *Payment) WithDisplayDescription(description string) *Payment {
+	p.description = description
+	return p
+}
+
+func (p *Payment) WithDueDate(due time.Time) *Payment {
+	p.due = ToDate(due.In(GreekTimeZone()))
+	p.hasDueDate = true
+	return p
+}
+
+// WithDueTime sets the due date along with a cutoff time on that date
+func (p *Payment) WithDueTime(due time.Time) *Payment {
+	p.WithDueDate(due)
+	p.dueTime = due.In(GreekTimeZone())
+	p.hasDueTime = true
+	return p
+}
+
+func (p *Payment) WithLeadDays(days int) *Payment {
+	p.leadDays = days
+	p.hasLeadDays = true
+	return p
+}
+
+func (p *Payment) WithAmount(amount float64) *Payment {
+	p.amount = amount
+	p.hasAmount = true
+	return p
+}
+
+func (p *Payment) WithCurrency(currency string) *Payment {
+	p.currency = currency
+	return p
+}
+
+func (p *Payment) WithCategory(category string) *Payment {
+	p.category = category
+	return p
+}
+
+func (p *Payment) WithTags(tags ...string) *Payment {
+	p.tags = append(p.tags, tags...)
+	return p
+}
+
+func (p *Payment) HasTag(tag string) bool {
+	for _, t := range p.tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Payment) AsPriority() *Payment {
+	p.priority = true
+	return p
+}
+
+func (p *Payment) AsOptional() *Payment {
+	p.optional = true
+	return p
+}
+
+// IsDue is true for scheduled payments (i.e. the ones with a due date)
+func (p *Payment) IsDue() bool {
+	return p.hasDueDate
+}
+
+// dueDate formats the due date (empty if there is none)
+func (p *Payment) dueDate() string {
+	if !p.IsDue() {
+		return ""
+	}
+	return p.due.Format(time.DateOnly)
+}
+
+// Label is the payment's description along with its cutoff time (if any)
+func (p *Payment) Label() string {
+	if p.hasDueTime {
+		return fmt.Sprintf("%s (by %s)", p.description, p.dueTime.Format("15:04"))
+	}
+	return p.description
+}
+
+func (p *Payment) DiffFromNowInDays(now time.Time) int {
+	now = ToDate(now.In(GreekTimeZone()))
+	d := p.due.Sub(now).Hours() / 24
+	return int(d)
+}
+
+// BusinessDaysFromNow is the number of business days (i.e. weekdays that
+// are not one of the holidays) after the day of now up to and including
+// the due date (negative for delayed payments)
+func (p *Payment) BusinessDaysFromNow(now time.Time, holidays []string) int {
+	isHoliday := map[string]bool{}
+	for _, date := range holidays {
+		isHoliday[date] = true
+	}
+	isBusinessDay := func(day time.Time) bool {
+		weekday := day.Weekday()
+		return weekday != time.Saturday && weekday != time.Sunday && !isHoliday[day.Format(time.DateOnly)]
+	}
+	diff := p.DiffFromNowInDays(now)
+	// walk from the earlier of the two days to the other one
+	from, sign := ToDate(now.In(GreekTimeZone())), 1
+	if diff < 0 {
+		from, sign, diff = p.due, -1, -diff
+	}
+	days := 0
+	for i := 1; i <= diff; i++ {
+		if isBusinessDay(from.AddDate(0, 0, i)) {
+			days++
+		}
+	}
+	return sign * days
+}
+
+// Check reads every configured sheet and writes to w whether it could be
+// read without parsing any payments or sending any notification
+func Check(config *Config, readers *Readers, w io.Writer) error {
+	sheets, err := ExpandSheets(readers, EnabledSheets(config.Sheets, log.Default()))
+	if err != nil {
+		return err
+	}
+	failed := []string{}
+	for _, sheet := range sheets {
+		rows, err := readSheet(readers, sheet)
+		if err != nil {
+			failed = append(failed, sheet.Name)
+			fmt.Fprintf(w, "[FAIL] %s: %v\n", sheet.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "[OK] %s: %d rows\n", sheet.Name, len(rows))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d out of %d sheets could not be read: %s", len(failed), len(sheets), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// RunOptions are the command line options that affect a run
+type RunOptions struct {
+	// print the report on screen as well (in color)
+	Print bool
+	Color bool
+	// write the report to this file as well (truncating it)
+	Out string
+	// build the report without sending it (or updating the state)
+	DryRun bool
+	// restrict the report to payments with this tag
+	OnlyTag string
+	// the time the report is produced for (defaults to the current time)
+	Now time.Time
+	// where the state is kept (defaults to the config's state_file)
+	State StateStore
+	// called with the report once it is built (if set)
+	OnReport func(report string)
+}
+
+// Run reads the payments of the config's sheets and sends their report
+// (keeping track of the reminders and changes in the state)
+func Run(config *Config, readers *Readers, notifier Notifier, opts *RunOptions) (err error) {
+	runID := newRunID()
+	// the log lines of the run are marked with its id (runs may overlap,
+	// e.g. on-demand and scheduled ones, so the global logger is left as is)
+	logger := log.New(log.Writer(), fmt.Sprintf("[run %s] ", runID), log.Flags()|log.Lmsgprefix)
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("run %s: %w", runID, err)
+		}
+	}()
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if until, paused, err := PausedUntil(config.PauseFile, now); err != nil {
+		return err
+	} else if paused {
+		logger.Printf("reports are paused until %s", until.Format(time.DateOnly))
+		return nil
+	}
+
+	read, err := ReadSheets(context.Background(), config, readers, now, logger)
+	if err != nil {
+		return err
+	}
+	sheets, payments, stale, sources := read.Sheets, read.Payments, read.Stale, read.Sources
+	// the payments of the failed sheets are missing so the state of the
+	// payments is only updated (e.g. for telling paid payments apart) when
+	// all sheets have been read
+	complete := len(read.Failed) == 0
+	if !complete {
+		ReportFailure(config, notifier, fmt.Errorf("%d of %d sheets could not be read: %s", len(read.Failed), len(sheets), SummarizeFailures(read.Failed)))
+	}
+
+	var store *ReminderStore
+	if config.MaxReminders > 0 || config.ShowChanges || config.HasQuietHours() || config.NotifyOncePerDay {
+		state := opts.State
+		if state == nil {
+			state = NewFileStateStore(config.StateFile)
+		}
+		if store, err = NewReminderStore(state); err != nil {
+			return fmt.Errorf("failed to load state: %v", err)
+		}
+	}
+
+	changes := ""
+	if config.ShowChanges && complete {
+		changes = SummarizeChanges(store.Changes(payments, now))
+		store.TakeSnapshot(payments, now)
+	}
+
+	if config.MaxReminders > 0 && complete {
+		// using all the pending payments (i.e. regardless of -only-tag)
+		store.Forget(payments)
+	}
+
+	if opts.OnlyTag != "" {
+		payments = FilterPaymentsByTag(payments, opts.OnlyTag)
+	}
+
+	// the payments reported earlier today are muted before counting the
+	// reminders (they are not reminded of again) -- a report deferred until
+	// after the quiet hours is neither counted nor recorded as reported
+	// since it is not sent yet (and may be dropped in favor of a later one)
+	quietUntil, quiet := config.QuietUntil(now)
+	deferred := quiet && config.QuietHoursMode == QuietHoursDefer
+	repeated := 0
+	if config.NotifyOncePerDay && !deferred {
+		repeated = store.Dedupe(payments, now)
+	}
+	if config.MaxReminders > 0 && !deferred {
+		store.Mute(payments, config.MaxReminders, now)
+	}
+
+	// format and send report
+	notes := []string{}
+	for _, name := range stale {
+		notes = append(notes, fmt.Sprintf("⚠ Sheet %s may be stale", name))
+	}
+	if config.ShowSources {
+		notes = append(notes, FormatSources(sources))
+	}
+	if config.ShowSheetLinks {
+		if links := FormatSheetLinks(unmutedPayments(payments)); links != "" {
+			notes = append(notes, links)
+		}
+	}
+	if config.RecapDays > 0 {
+		paid := read.Paid
+		if opts.OnlyTag != "" {
+			paid = FilterPaymentsByTag(paid, opts.OnlyTag)
+		}
+		if recap := FormatRecap(paid, config.RecapDays, now); recap != "" {
+			notes = append(notes, recap)
+		}
+	}
+	if failures := SummarizeFailures(read.Failed); failures != "" {
+		notes = append(notes, failures)
+	}
+	report := BuildReport(config, payments, now, append([]string{changes}, notes...)...)
+
+	if opts.OnReport != nil {
+		opts.OnReport(report)
+	}
+	if opts.Print {
+		if opts.Color {
+			fmt.Print(Colorize(report))
+		} else {
+			fmt.Print(report)
+		}
+	}
+	if opts.Out != "" {
+		if err := os.WriteFile(opts.Out, []byte(report+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %v", err)
+		}
+	}
+
+	messages := []*ReportSection{{Title: "Payment Report", Text: report}}
+	if config.SplitNotifications {
+		messages = SplitReport(config, payments, now, changes, notes)
+	}
+
+	reportable := reportablePayments(config, payments)
+	notifications := []*Notification{}
+	for i, message := range messages {
+		// only the first message is forwarded and carries the actions (so
+		// that split notifications do not repeat them)
+		notifications = append(notifications, newReportNotification(config, reportable, now, runID, message, i == 0))
+	}
+	if config.AttachDetails {
+		// the first notification carries all the payments
+		details, err := PaymentsCSV(payments, now)
+		if err != nil {
+			return fmt.Errorf("failed to build the details: %v", err)
+		}
+		notifications[0].Attachment, notifications[0].Filename = details, DetailsFilename(now)
+	}
+
+	skipDay := config.IsSkipDay(now)
+	empty := config.SuppressEmpty && changes == "" && len(notes) == 0 && IsEmptyReport(BuildSections(config, payments, now))
+	// nothing new since the earlier reports of today
+	unchanged := repeated > 0 && changes == "" && len(unmutedPayments(payments)) == 0
+	skipped := opts.DryRun || skipDay || empty || unchanged || (quiet && config.QuietHoursMode == QuietHoursSkip)
+	if opts.DryRun {
+		logger.Printf("dry run: not sending the report")
+	} else if skipDay {
+		logger.Printf("not sending the report on a skip day:\n%s", report)
+	} else if empty {
+		logger.Printf("not sending an empty report")
+	} else if unchanged {
+		logger.Printf("not sending the report (all %d payments were reported earlier today)", repeated)
+	} else if quiet && config.QuietHoursMode == QuietHoursSkip {
+		logger.Printf("not sending the report during quiet hours (until %s)", quietUntil.Format(time.RFC3339))
+	} else if quiet {
+		// the report is sent once the quiet hours are over (see DeliverPending)
+		store.Pending = &PendingReport{Until: quietUntil, Notifications: notifications}
+		logger.Printf("deferring the report until the end of quiet hours (%s)", quietUntil.Format(time.RFC3339))
+	} else {
+		if store != nil && store.Pending != nil {
+			logger.Printf("dropping the deferred report (until %s) in favor of this one", store.Pending.Until.Format(time.RFC3339))
+			store.Pending = nil
+		}
+		for _, notification := range notifications {
+			if err = notifier.Notify(notification); err != nil {
+				break
+			}
+		}
+	}
+	logger.Printf("run summary: sheets=%d payments=%d delayed=%d today=%d upcoming=%d notified=%v",
+		len(sheets), len(payments),
+		len(FindPaymentsUntil(reportable, -1, now)),
+		len(FindPaymentsAt(reportable, 0, now)),
+		len(FindPaymentsFrom(reportable, 1, now)),
+		err == nil && !skipped && !quiet)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %v", err)
+	}
+	if skipped {
+		return nil
+	}
+	// reminders (and changes) only count once they have been delivered
+	if store != nil {
+		if err := store.Save(); err != nil {
+			return fmt.Errorf("failed to save state: %v", err)
+		}
+	}
+	return nil
+}
+
+// SheetPayments holds the (pending) payments read from the (expanded)
+// sheets along with the paid ones, the stale sheets, the number of
+// payments per sheet and the sheets that could not be read
+type SheetPayments struct {
+	Sheets   []*Sheet
+	Payments []*Payment
+	Paid     []*Payment
+	Stale    []string
+	Sources  []SheetCount
+	Failed   []SheetError
+}
+
+// SheetError is the reason a sheet could not be read
+type SheetError struct {
+	Name string
+	Err  error
+}
+
+// SummarizeFailures notes the sheets that could not be read (and why)
+func SummarizeFailures(failed []SheetError) string {
+	if len(failed) == 0 {
+		return ""
+	}
+	reasons := []string{}
+	for _, f := range failed {
+		reasons = append(reasons, fmt.Sprintf("%s (%v)", f.Name, f.Err))
+	}
+	return "⚠ Errors reading: " + strings.Join(reasons, ", ")
+}
+
+// ReadSheets reads the payments of all the configured sheets; sheets that
+// can not be read are skipped (and listed in Failed) unless none of the
+// sheets could be read, in which case all the errors are returned -- the
+// skipped sheets (and the retries of the readers) are logged to logger
+func ReadSheets(ctx context.Context, config *Config, readers *Readers, now time.Time, logger *log.Logger) (*SheetPayments, error) {
+	readers = readers.WithLogger(logger)
+	sheets, err := ExpandSheets(readers, EnabledSheets(config.Sheets, logger))
+	if err != nil {
+		return nil, err
+	}
+
+	read := &SheetPayments{Sheets: sheets, Payments: []*Payment{}, Paid: []*Payment{}, Stale: []string{}, Sources: []SheetCount{}, Failed: []SheetError{}}
+	errs := []error{}
+	fail := func(name string, reason, err error) {
+		logger.Printf("skipping sheet %s: %v", name, err)
+		read.Failed = append(read.Failed, SheetError{Name: name, Err: reason})
+		errs = append(errs, err)
+	}
+
+	// sheets of the same spreadsheet are fetched using a single call
+	for _, group := range GroupSheetsBySpreadsheet(sheets) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, sheet := range group {
+			names = append(names, sheet.Name)
+		}
+		values, err := readers.For(group[0]).Read(group[0].Location(), names...)
+		if err != nil {
+			wrapped := fmt.Errorf("failed to read sheets %s: %v", strings.Join(names, ", "), err)
+			for _, name := range names {
+				fail(name, err, wrapped)
+			}
+			continue
+		}
+		for _, sheet := range group {
+			rows := values[sheet.Name]
+			if len(rows) <= sheet.HeaderRow+1 {
+				fail(sheet.Name, ErrNoData, fmt.Errorf("failed to read sheet %s: %w", sheet.Name, ErrNoData))
+				continue
+			}
+			p, paid, err := readSheetPayments(rows, sheet, now, logger)
+			if err != nil {
+				fail(sheet.Name, err, fmt.Errorf("failed to read payments from sheet '%s': %w", sheet.Name, err))
+				continue
+			}
+			if config.StaleAfterDays > 0 && IsStale(p, config.StaleAfterDays, now) {
+				read.Stale = append(read.Stale, sheet.Name)
+			}
+			read.Payments = append(read.Payments, p...)
+			read.Paid = append(read.Paid, paid...)
+			read.Sources = append(read.Sources, SheetCount{Name: sheet.Name, Count: len(p)})
+		}
+	}
+	if len(read.Failed) > 0 && len(read.Failed) == len(sheets) {
+		return nil, errors.Join(errs...)
+	}
+	return read, nil
+}
+
+// Report reads the sheets of config and returns the report of the
+// payments without sending it; unlike Run it does not depend on the state
+// file or a notifier so that it can be used by other programs
+func Report(ctx context.Context, config *Config) (string, error) {
+	readers, err := NewReaders(config)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	read, err := ReadSheets(ctx, config, readers, now, log.Default())
+	if err != nil {
+		return "", err
+	}
+	return BuildReport(config, read.Payments, now), nil
+}
+
+// SplitReport returns a message per section with something to report
+// followed by the changes and the notes (if any)
+func SplitReport(config *Config, payments []*Payment, now time.Time, changes string, notes []string) []*ReportSection {
+	messages := []*ReportSection{}
+	for _, section := range BuildSections(config, payments, now) {
+		if !section.HasNothing() {
+			messages = append(messages, section)
+		}
+	}
+	if changes != "" {
+		messages = append(messages, &ReportSection{Title: "Payment Changes", Text: changes})
+	}
+	if len(notes) > 0 {
+		messages = append(messages, &ReportSection{Title: "Payment Report Notes", Text: strings.Join(notes, "\n")})
+	}
+	if len(messages) == 0 {
+		messages = append(messages, &ReportSection{Title: "Payment Report", Text: NothingToReport})
+	}
+	return messages
+}
+
+// newReportNotification creates the notification of a report message; the
+// primary message also carries the actions and the email/call forwarding
+func newReportNotification(config *Config, reportable []*Payment, now time.Time, runID string, message *ReportSection, primary bool) *Notification {
+	// the payments left out of the delayed section do not make the report
+	// more urgent either
+	recent := withinMaxOverdue(reportable, now, config)
+	notification := &Notification{
+		Topic:    config.NotificationTopic,
+		Title:    message.Title,
+		Message:  message.Text,
+		Tags:     ReportTag(config, recent, now),
+		Priority: OverduePriority(recent, now),
+		Click:    config.ClickURL,
+	}
+	if primary {
+		actions := []string{}
+		if config.ViewButton && config.ClickURL != "" {
+			actions = append(actions, fmt.Sprintf("view, View Sheet, %s", config.ClickURL))
+		}
+		if config.CallbackURL != "" {
+			// ntfy supports up to 3 actions per notification
+			due := SortPaymentsByDueDate(FindPaymentsUntil(reportable, 0, now))
+			actions = append(actions, PaidActions(due, config.CallbackURL, config.CallbackSecret, now.Add(PaidButtonTTL), MaxNtfyActions-len(actions))...)
+		}
+		notification.Actions = strings.Join(actions, "; ")
+		if notification.Priority >= config.ForwardMinPriority {
+			notification.Email = config.ForwardEmail
+			notification.Call = config.ForwardCall
+		}
+	}
+	// overdue payments only raise the configured priority
+	if config.NtfyPriority > notification.Priority {
+		notification.Priority = config.NtfyPriority
+	}
+	if config.ShowRunID {
+		notification.Tags = strings.Trim(notification.Tags+",run-"+runID, ",")
+	}
+	return notification
+}
+
+// newRunID returns a short random id for correlating a run's log lines
+// with its notification
+func newRunID() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+// Version is set at build time (using -ldflags
+// "-X github.com/kkentzo/remindme.Version=...")
+var Version = "dev"
+
+// ParseAsOf parses the date of -as-of (in athens time) keeping the time of
+// day of now so that the report is previewed as if it ran on that date
+func ParseAsOf(value string, now time.Time) (time.Time, error) {
+	date, err := time.ParseInLocation(time.DateOnly, value, GreekTimeZone())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -as-of date %q: %v", value, err)
+	}
+	now = now.In(GreekTimeZone())
+	return time.Date(date.Year(), date.Month(), date.Day(), now.Hour(), now.Minute(), now.Second(), 0, GreekTimeZone()), nil
+}
+
+// SheetCount is the number of (pending) payments read from a sheet
+type SheetCount struct {
+	Name  string
+	Count int
+}
+
+// FormatSources formats the number of payments of each sheet as a footer
+func FormatSources(sources []SheetCount) string {
+	counts := []string{}
+	for _, source := range sources {
+		counts = append(counts, fmt.Sprintf("%s (%d)", source.Name, source.Count))
+	}
+	return "📚 Sources: " + strings.Join(counts, ", ")
+}
+
+// FormatRecap lists the payments paid within the last days (according to
+// their payment date) as a footer
+func FormatRecap(paid []*Payment, days int, now time.Time) string {
+	today := ToDate(now.In(GreekTimeZone()))
+	since := today.AddDate(0, 0, -days)
+	recent := []string{}
+	for _, p := range paid {
+		if p.paidOn.IsZero() || p.paidOn.Before(since) || p.paidOn.After(today) {
+			continue
+		}
+		recent = append(recent, p.description)
+	}
+	if len(recent) == 0 {
+		return ""
+	}
+	return "✅ Paid recently: " + strings.Join(recent, ", ")
+}
+
+// SpreadsheetURL is the url of a google spreadsheet
+func SpreadsheetURL(spreadsheetId string) string {
+	return "https://docs.google.com/spreadsheets/d/" + spreadsheetId
+}
+
+// FormatSheetLinks lists the links to the spreadsheets of the payments
+// (once per spreadsheet) as a footer
+func FormatSheetLinks(payments []*Payment) string {
+	links := []string{}
+	seen := map[string]bool{}
+	for _, p := range payments {
+		if p.spreadsheetId == "" || seen[p.spreadsheetId] {
+			continue
+		}
+		seen[p.spreadsheetId] = true
+		links = append(links, SpreadsheetURL(p.spreadsheetId))
+	}
+	if len(links) == 0 {
+		return ""
+	}
+	return "🔗 Sheets: " + strings.Join(links, " ")
+}
+
+// NextRun returns the earliest next run of all the cron entries
+func NextRun(entries []cron.Entry) time.Time {
+	next := time.Time{}
+	for _, entry := range entries {
+		if next.IsZero() || entry.Next.Before(next) {
+			next = entry.Next
+		}
+	}
+	return next
+}
+
+// ReportFailure notifies the error topic (if configured) about a failed run
+func ReportFailure(config *Config, notifier Notifier, err error) {
+	if config.ErrorTopic == "" {
+		return
+	}
+	notification := &Notification{
+		Topic:    config.ErrorTopic,
+		Title:    "Payment Report Failed",
+		Message:  err.Error(),
+		Tags:     "warning",
+		Priority: PriorityHigh,
+	}
+	if err := notifier.Notify(notification); err != nil {
+		log.Printf("failed to send failure notification: %v", err)
+	}
+}
+
+// BuildReport assembles the report sections in the configured order
+// followed by the (non empty) extras, e.g. the changes and the notes, and
+// truncates the whole report to max_report_bytes
+func BuildReport(config *Config, payments []*Payment, now time.Time, extras ...string) string {
+	lines := reportSections(config, payments, now)
+	for _, extra := range extras {
+		if extra != "" {
+			lines = append(lines, extra)
+		}
+	}
+	return TruncateReport(lines, config.MaxReportBytes)
+}
+
+// reportSections returns the (untruncated) sections of the report or the
+// lines of its template/digest
+func reportSections(config *Config, payments []*Payment, now time.Time) []string {
+	if config.reportTemplate != nil {
+		report, err := RenderReport(config.reportTemplate, NewReportData(config, payments, now))
+		if err == nil {
+			return strings.Split(report, "\n")
+		}
+		log.Printf("failed to render the report template (using the default format): %v", err)
+	}
+	if config.ReportMode == ReportModeWeekly {
+		digest := SummarizeWeek(reportablePayments(config, payments), now, config.DisplayDateFormat)
+		return strings.Split(digest, "\n")
+	}
+	sections := []string{}
+	for _, section := range BuildSections(config, payments, now) {
+		sections = append(sections, section.Text)
+	}
+	if len(sections) == 0 {
+		sections = append(sections, NothingToReport)
+	}
+	return sections
+}
+
+// ReportSection is a section of the report along with the title of its
+// notification when sections are sent separately
+type ReportSection struct {
+	Title string
+	Text  string
+	// the section's key (empty for messages other than sections)
+	Key string
+}
+
+var sectionTitles = map[string]string{
+	SectionPriority:  "Priority Payments",
+	SectionDueSoon:   "Payments Due Soon",
+	SectionToday:     "Payments Due Today",
+	SectionDelayed:   "Delayed Payments",
+	SectionComingUp:  "Payments Coming Up",
+	SectionThisMonth: "Payments This Month",
+	SectionUndated:   "Undated Payments",
+	SectionOptional:  "Optional Payments",
+	SectionTotal:     "Payments Total",
+}
+
+// BuildSections summarizes the payments in each of the enabled sections
+// (in order) leaving out the empty ones
+func BuildSections(config *Config, payments []*Payment, now time.Time) []*ReportSection {
+	required, optional := PartitionOptionalPayments(payments)
+	reportable := reportablePayments(config, payments)
+	// priority payments are listed in their own section regardless of when
+	// they are due (or their amount) so they are left out of the windowed
+	// sections
+	priority, _ := PartitionPriorityPayments(unmutedPayments(required))
+	optional = unmutedPayments(optional)
+	_, windowed := PartitionPriorityPayments(reportable)
+
+	if config.ReportMode == ReportModeWeekly {
+		return []*ReportSection{{Title: "Payments This Week", Text: SummarizeWeek(reportable, now, config.DisplayDateFormat)}}
+	}
+
+	summarizers := map[string]func() string{
+		SectionPriority:  func() string { return SummarizePriority(priority, config) },
+		SectionDueSoon:   func() string { return SummarizeDueSoon(windowed, now, config) },
+		SectionToday:     func() string { return SummarizePaymentsForToday(windowed, now, config) },
+		SectionDelayed:   func() string { return SummarizeDelayedPayments(windowed, now, config) },
+		SectionComingUp:  func() string { return SummarizePaymentsComingUp(windowed, now, config) },
+		SectionThisMonth: func() string { return SummarizeThisMonth(windowed, now, config) },
+		SectionUndated:   func() string { return SummarizeUndated(windowed, config) },
+		SectionOptional:  func() string { return SummarizeOptional(optional, config) },
+		SectionTotal: func() string {
+			total := SummarizeTotalPayments(required, config.TotalWindowDays, now)
+			if budget := SummarizeBudget(required, config.TotalWindowDays, config.MonthlyBudget, now); budget != "" {
+				total += "\n" + budget
+			}
+			return total
+		},
+	}
+
+	sections := []*ReportSection{}
+	for _, key := range config.SectionOrder {
+		if !config.IsSectionEnabled(key) {
+			continue
+		}
+		if key == SectionDelayed && config.MergeDelayedIntoToday {
+			// listed in the today section
+			continue
+		}
+		if summary := summarizers[key](); summary != "" {
+			sections = append(sections, &ReportSection{Title: sectionTitles[key], Text: summary, Key: key})
+		}
+	}
+	return sections
+}
+
+// TruncateReport joins the sections into a report of up to maxBytes (if
+// positive) by dropping trailing sections and noting how many were dropped
+func TruncateReport(sections []string, maxBytes int) string {
+	report := strings.Join(sections, "\n")
+	if maxBytes <= 0 || len(report) <= maxBytes {
+		return report
+	}
+	for n := len(sections) - 1; n > 0; n-- {
+		note := fmt.Sprintf("… (%d more)", len(sections)-n)
+		if report = strings.Join(append(sections[:n:n], note), "\n"); len(report) <= maxBytes {
+			return report
+		}
+	}
+	return fmt.Sprintf("… (%d more)", len(sections))
+}
+
+// reportablePayments returns the payments that are worth a reminder
+func reportablePayments(config *Config, payments []*Payment) []*Payment {
+	required, _ := PartitionOptionalPayments(unmutedPayments(payments))
+	// small payments are not worth a reminder but still count towards the total
+	return FilterPaymentsByMinAmount(required, config.MinAmount)
+}
+
+// unmutedPayments leaves out the muted payments (which still count
+// towards the totals)
+func unmutedPayments(payments []*Payment) []*Payment {
+	found := []*Payment{}
+	for _, p := range payments {
+		if !p.muted {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+func SummarizeDelayedPayments(payments []*Payment, now time.Time, config *Config) string {
+	delayed, ancient := findDelayedPayments(payments, now, config)
+	lines := []string{}
+	if len(delayed) > 0 {
+		lines = append(lines, "⚠ Delayed:"+describePayments(delayed, config))
+	}
+	if ancient != "" {
+		lines = append(lines, ancient)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withinMaxOverdue leaves out the payments overdue for more than
+// max_overdue_days (if set)
+func withinMaxOverdue(payments []*Payment, now time.Time, config *Config) []*Payment {
+	if config.MaxOverdueDays <= 0 {
+		return payments
+	}
+	return FindPaymentsFrom(payments, -config.MaxOverdueDays, now)
+}
+
+// findDelayedPayments returns the delayed payments along with a note about
+// the ones overdue for more than max_overdue_days (which are left out)
+func findDelayedPayments(payments []*Payment, now time.Time, config *Config) ([]*Payment, string) {
+	delayed := FindPaymentsUntil(payments, -1, now)
+	recent := withinMaxOverdue(delayed, now, config)
+	if ancient := len(delayed) - len(recent); ancient > 0 {
+		return recent, fmt.Sprintf("🦕 %s overdue for more than %s", pluralize(ancient, "payment"), pluralize(config.MaxOverdueDays, "day"))
+	}
+	return recent, ""
+}
+
+// markOverdue returns copies of the payments with their descriptions
+// marked as overdue
+func markOverdue(payments []*Payment) []*Payment {
+	marked := []*Payment{}
+	for _, p := range payments {
+		c := *p
+		c.description += " (overdue)"
+		marked = append(marked, &c)
+	}
+	return marked
+}
+
+func SummarizePaymentsForToday(payments []*Payment, now time.Time, config *Config) string {
+	today := FindPaymentsAt(payments, 0, now)
+	scheduled := today
+	if config.HasSection(SectionDueSoon) {
+		// the ones due soon are listed in their own section
+		scheduled = FindPaymentsAfterHours(today, config.DueSoonHours, now)
+	}
+
+	ancient := ""
+	if config.MergeDelayedIntoToday {
+		// the delayed payments are listed first (there is no delayed section)
+		var delayed []*Payment
+		delayed, ancient = findDelayedPayments(payments, now, config)
+		scheduled = append(markOverdue(delayed), scheduled...)
+	}
+
+	lines := []string{}
+	if len(scheduled) > 0 {
+		lines = append(lines, "💸 Today:"+describePayments(scheduled, config))
+	}
+	if ancient != "" {
+		lines = append(lines, ancient)
+	}
+	if len(lines) > 0 {
+		return strings.Join(lines, "\n")
+	}
+	if len(today) > 0 {
+		// all of them are due soon
+		return ""
+	}
+	return NothingForToday
+}
+
+func SummarizePaymentsComingUp(payments []*Payment, now time.Time, config *Config) string {
+	comingUp := PaymentsComingUp(payments, now, config)
+	if len(comingUp) == 0 {
+		return NothingComingUp
+	}
+
+	label := config.ComingUpLabel
+	if label == "" {
+		label = DefaultComingUpLabel
+	}
+	message := fmt.Sprintf("⏳ %s (%s):", label, comingUp[0].due.Format(config.DisplayDateFormat))
+	return message + describePayments(comingUp, config)
+}
+
+// SummarizeDueSoon lists the payments due today with a due time within the
+// next due_soon_hours (or already past)
+func SummarizeDueSoon(payments []*Payment, now time.Time, config *Config) string {
+	soon := PaymentsDueSoon(payments, config.DueSoonHours, now)
+	if len(soon) == 0 {
+		return ""
+	}
+	return "🚨 Due soon:" + describePayments(soon, config)
+}
+
+// PaymentsDueSoon returns the payments due today whose due time is at most
+// hours away
+func PaymentsDueSoon(payments []*Payment, hours int, now time.Time) []*Payment {
+	found := []*Payment{}
+	for _, p := range FindPaymentsAt(payments, 0, now) {
+		if p.hasDueTime && p.dueTime.Sub(now) <= time.Duration(hours)*time.Hour {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// FindPaymentsAfterHours returns the payments that are not due soon (i.e.
+// the ones without a due time or due more than hours away)
+func FindPaymentsAfterHours(payments []*Payment, hours int, now time.Time) []*Payment {
+	soon := map[*Payment]bool{}
+	for _, p := range PaymentsDueSoon(payments, hours, now) {
+		soon[p] = true
+	}
+	found := []*Payment{}
+	for _, p := range payments {
+		if !soon[p] {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// PaymentsComingUp returns the payments of the next due date (after today)
+// among the ones that are within their lead time
+func PaymentsComingUp(payments []*Payment, now time.Time, config *Config) []*Payment {
+	futurePayments := []*Payment{}
+	for _, p := range FindPaymentsFrom(payments, 1, now) {
+		if isComingUp(p, now, config) {
+			futurePayments = append(futurePayments, p)
+		}
+	}
+
+	sort.Slice(futurePayments, func(i, j int) bool {
+		return futurePayments[i].due.Before(futurePayments[j].due)
+	})
+
+	// figure out next payment due date and corresponding payments
+	nextTs := time.Time{}
+	comingUp := []*Payment{}
+
+	for _, p := range futurePayments {
+		if nextTs.IsZero() {
+			nextTs = p.due
+			comingUp = append(comingUp, p)
+		} else if p.DiffFromNowInDays(nextTs) == 0 {
+			comingUp = append(comingUp, p)
+		}
+	}
+	return comingUp
+}
+
+// isComingUp is true if the payment is due within its lead days or, if it
+// has none, within the global coming up window (if any)
+func isComingUp(p *Payment, now time.Time, config *Config) bool {
+	lead := config.ComingUpDays
+	if p.hasLeadDays {
+		lead = p.leadDays
+	} else if lead == 0 {
+		return true
+	}
+	return config.DaysUntil(p, now) <= lead
+}
+
+// DaysUntil is the number of days from now until the payment's due date;
+// only business days are counted with business_days
+func (c *Config) DaysUntil(p *Payment, now time.Time) int {
+	if !c.BusinessDays {
+		return p.DiffFromNowInDays(now)
+	}
+	return p.BusinessDaysFromNow(now, c.Holidays)
+}
+
+// SummarizeThisMonth lists the payments due after today (except for the
+// ones coming up) and until the end of the month or, if set,
+// within this_month_days
+func SummarizeThisMonth(payments []*Payment, now time.Time, config *Config) string {
+	later := PaymentsThisMonth(payments, now, config)
+	if len(later) == 0 {
+		return ""
+	}
+	return "📅 This month:" + describePayments(later, config)
+}
+
+// PaymentsThisMonth returns the payments due after the coming up ones until
+// the end of the month (or within this_month_days)
+func PaymentsThisMonth(payments []*Payment, now time.Time, config *Config) []*Payment {
+	future := SortPaymentsByDueDate(FindPaymentsFrom(payments, 1, now))
+	comingUp := map[*Payment]bool{}
+	for _, p := range PaymentsComingUp(payments, now, config) {
+		comingUp[p] = true
+	}
+	horizon := config.ThisMonthDays
+	if horizon == 0 {
+		today := ToDate(now.In(GreekTimeZone()))
+		horizon = today.AddDate(0, 1, -today.Day()).Day() - today.Day()
+	}
+
+	later := []*Payment{}
+	for _, p := range future {
+		if !comingUp[p] && p.DiffFromNowInDays(now) <= horizon {
+			later = append(later, p)
+		}
+	}
+	return later
+}
+
+// SummarizeChanges lists the payments that became delayed, were paid or
+// were added since the last run
+func SummarizeChanges(delayed, paid, added []string) string {
+	lines := []string{}
+	if len(delayed) > 0 {
+		lines = append(lines, "  Delayed: "+strings.Join(delayed, ", "))
+	}
+	if len(paid) > 0 {
+		lines = append(lines, "  Paid: "+strings.Join(paid, ", "))
+	}
+	if len(added) > 0 {
+		lines = append(lines, "  New: "+strings.Join(added, ", "))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "🔔 Changes:\n" + strings.Join(lines, "\n")
+}
+
+// SummarizeWeek lists the payments due in the next 7 days grouped by weekday
+func SummarizeWeek(payments []*Payment, now time.Time, dateFormat string) string {
+	days := []string{}
+	for diff := 0; diff < 7; diff++ {
+		scheduled := FindPaymentsAt(payments, diff, now)
+		if len(scheduled) == 0 {
+			continue
+		}
+		day := scheduled[0].due
+		descriptions := []string{}
+		for _, p := range scheduled {
+			descriptions = append(descriptions, p.Label())
+		}
+		days = append(days, fmt.Sprintf("%s %s: %s", day.Weekday().String()[:3], day.Format(dateFormat), strings.Join(descriptions, ", ")))
+	}
+	if len(days) == 0 {
+		return NothingThisWeek
+	}
+	return "🗓 This week:\n" + strings.Join(days, "\n")
+}
+
+// SummarizePriority lists all the payments of the priority sheets
+func SummarizePriority(payments []*Payment, config *Config) string {
+	if len(payments) == 0 {
+		return ""
+	}
+	return "❗ Priority:" + describePayments(payments, config)
+}
+
+// SummarizeUndated lists the payments without a due date (which would
+// otherwise not appear in any section)
+func SummarizeUndated(payments []*Payment, config *Config) string {
+	undated := FindUndatedPayments(payments)
+	if len(undated) == 0 {
+		return ""
+	}
+	return "📌 Undated:" + describePayments(undated, config)
+}
+
+// FindUndatedPayments returns the payments without a due date
+func FindUndatedPayments(payments []*Payment) []*Payment {
+	found := []*Payment{}
+	for _, p := range payments {
+		if !p.IsDue() {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+func SummarizeOptional(payments []*Payment, config *Config) string {
+	if len(payments) == 0 {
+		return ""
+	}
+	return "ℹ Optional:" + describePayments(payments, config)
+}
+
+// describePayments lists the payment descriptions (in sort_by order and up
+// to max_per_section) either inline or, when grouping by category, as one
+// indented line per category
+func describePayments(payments []*Payment, config *Config) string {
+	payments = config.SortPayments(payments)
+	more := ""
+	if config.MaxPerSection > 0 && len(payments) > config.MaxPerSection {
+		more = fmt.Sprintf("… and %d more", len(payments)-config.MaxPerSection)
+		payments = payments[:config.MaxPerSection]
+	}
+
+	categories := []string{}
+	grouped := map[string][]*Payment{}
+	for _, p := range payments {
+		if p.category == "" {
+			continue
+		}
+		if _, ok := grouped[p.category]; !ok {
+			categories = append(categories, p.category)
+		}
+		grouped[p.category] = append(grouped[p.category], p)
+	}
+	if !config.GroupByCategory || len(categories) == 0 {
+		if more != "" {
+			return " " + joinDescriptions(payments) + " " + more
+		}
+		return " " + joinDescriptions(payments)
+	}
+	lines := []string{}
+	for _, category := range categories {
+		lines = append(lines, fmt.Sprintf("  %s: %s", category, joinDescriptions(grouped[category])))
+	}
+	uncategorized := []*Payment{}
+	for _, p := range payments {
+		if p.category == "" {
+			uncategorized = append(uncategorized, p)
+		}
+	}
+	if len(uncategorized) > 0 {
+		lines = append(lines, fmt.Sprintf("  Other: %s", joinDescriptions(uncategorized)))
+	}
+	if more != "" {
+		lines = append(lines, "  "+more)
+	}
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// SortPaymentsByDueDate returns a copy of the payments sorted by due date
+// (earliest first) with undated payments last
+func SortPaymentsByDueDate(payments []*Payment) []*Payment {
+	sorted := append([]*Payment{}, payments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].IsDue() || !sorted[j].IsDue() {
+			return sorted[i].IsDue() && !sorted[j].IsDue()
+		}
+		if sorted[i].due.Equal(sorted[j].due) && sorted[i].hasDueTime != sorted[j].hasDueTime {
+			// payments with a cutoff time come first within their day
+			return sorted[i].hasDueTime
+		}
+		if sorted[i].hasDueTime && sorted[j].hasDueTime {
+			return sorted[i].dueTime.Before(sorted[j].dueTime)
+		}
+		return sorted[i].due.Before(sorted[j].due)
+	})
+	return sorted
+}
+
+// SortPayments returns a copy of the payments in sort_by order; when
+// sorting by amount, payments without an amount come last and payments of
+// the same amount are sorted by due date
+func (c *Config) SortPayments(payments []*Payment) []*Payment {
+	sorted := SortPaymentsByDueDate(payments)
+	if c.SortBy != SortByAmount {
+		return sorted
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].hasAmount || !sorted[j].hasAmount {
+			return sorted[i].hasAmount && !sorted[j].hasAmount
+		}
+		return sorted[i].amount > sorted[j].amount
+	})
+	return sorted
+}
+
+func joinDescriptions(payments []*Payment) string {
+	descriptions := []string{}
+	for _, p := range payments {
+		descriptions = append(descriptions, p.Label())
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func SummarizeTotalPayments(payments []*Payment, timeWindowInDays int, now time.Time) string {
+	n := 0
+	currencies := []string{}
+	totals := map[string]float64{}
+	for _, p := range payments {
+		// undated payments are not due within any window
+		if p.IsDue() && p.DiffFromNowInDays(now) <= timeWindowInDays {
+			n += 1
+			if !p.hasAmount {
+				continue
+			}
+			if _, ok := totals[p.currency]; !ok {
+				currencies = append(currencies, p.currency)
+			}
+			totals[p.currency] += p.amount
+		}
+	}
+	if len(currencies) == 0 {
+		return fmt.Sprintf("💰 Total %s pending during the next %s", pluralize(n, "payment"), pluralize(timeWindowInDays, "day"))
+	}
+	amounts := []string{}
+	for _, currency := range currencies {
+		amounts = append(amounts, formatMoney(totals[currency], currency))
+	}
+	return fmt.Sprintf("💰 %s due in next %s", strings.Join(amounts, ", "), pluralize(timeWindowInDays, "day"))
+}
+
+// SummarizeBudget compares the amounts due within the time window to the
+// monthly budget prorated to the window; there is nothing to compare
+// without a budget or when the amounts are missing or in more than one
+// currency
+func SummarizeBudget(payments []*Payment, timeWindowInDays int, monthlyBudget float64, now time.Time) string {
+	if monthlyBudget <= 0 {
+		return ""
+	}
+	currency := ""
+	projected := 0.0
+	found := false
+	for _, p := range payments {
+		// undated payments are not due within the window
+		if !p.hasAmount || !p.IsDue() || p.DiffFromNowInDays(now) > timeWindowInDays {
+			continue
+		}
+		if found && p.currency != currency {
+			return ""
+		}
+		currency = p.currency
+		projected += p.amount
+		found = true
+	}
+	if !found {
+		return ""
+	}
+	budget := monthlyBudget * float64(timeWindowInDays) / 30
+	summary := fmt.Sprintf("📊 Budget: %s projected vs %s budgeted for the next %s",
+		formatMoney(projected, currency), formatMoney(budget, currency), pluralize(timeWindowInDays, "day"))
+	if projected > budget {
+		summary += fmt.Sprintf(" ⚠ over by %s", formatMoney(projected-budget, currency))
+	}
+	return summary
+}
+
+// pluralize formats the count along with the noun (in plural form unless n is 1)
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatMoney formats the amount with thousands separators (and decimals
+// only when needed) preceded by the currency symbol (or code)
+func formatMoney(amount float64, currency string) string {
+	formatted := formatAmount(amount)
+	if utf8.RuneCountInString(currency) > 1 {
+		return currency + " " + formatted
+	}
+	return currency + formatted
+}
+
+func formatAmount(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	formatted := strconv.FormatFloat(amount, 'f', 2, 64)
+	integer, decimals, _ := strings.Cut(formatted, ".")
+	for i := len(integer) - 3; i > 0; i -= 3 {
+		integer = integer[:i] + "," + integer[i:]
+	}
+	if decimals == "00" {
+		return sign + integer
+	}
+	return sign + integer + "." + decimals
+}
+
+func FindPaymentsAt(payments []*Payment, diff int, now time.Time) []*Payment {
+	found := []*Payment{}
+	for _, p := range payments {
+		// skip non-due payments
+		if !p.IsDue() {
+			continue
+		}
+		if p.DiffFromNowInDays(now) == diff {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+func FindPaymentsUntil(payments []*Payment, maxDiff int, now time.Time) []*Payment {
+	delayed := []*Payment{}
+	for _, p := range payments {
+		// skip non-due payments
+		if !p.IsDue() {
+			continue
+		}
+		if p.DiffFromNowInDays(now) <= maxDiff {
+			delayed = append(delayed, p)
+		}
+	}
+	return delayed
+}
+
+func FindPaymentsFrom(payments []*Payment, minDiff int, now time.Time) []*Payment {
+	found := []*Payment{}
+	for _, p := range payments {
+		// skip non-due payments
+		if !p.IsDue() {
+			continue
+		}
+		if p.DiffFromNowInDays(now) >= minDiff {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// IsStale is true if the newest due date of the payments is more than
+// staleAfterDays in the past (i.e. the sheet is probably not kept up to date)
+func IsStale(payments []*Payment, staleAfterDays int, now time.Time) bool {
+	var newest *Payment
+	for _, p := range payments {
+		if p.IsDue() && (newest == nil || p.due.After(newest.due)) {
+			newest = p
+		}
+	}
+	return newest != nil && newest.DiffFromNowInDays(now) < -staleAfterDays
+}
+
+// PartitionOptionalPayments separates the required from the optional payments
+func PartitionOptionalPayments(payments []*Payment) (required []*Payment, optional []*Payment) {
+	required = []*Payment{}
+	optional = []*Payment{}
+	for _, p := range payments {
+		if p.optional {
+			optional = append(optional, p)
+		} else {
+			required = append(required, p)
+		}
+	}
+	return required, optional
+}
+
+// PartitionPriorityPayments separates the priority from the other payments
+func PartitionPriorityPayments(payments []*Payment) (priority []*Payment, other []*Payment) {
+	priority = []*Payment{}
+	other = []*Payment{}
+	for _, p := range payments {
+		if p.priority {
+			priority = append(priority, p)
+		} else {
+			other = append(other, p)
+		}
+	}
+	return priority, other
+}
+
+func FilterPaymentsByTag(payments []*Payment, tag string) []*Payment {
+	found := []*Payment{}
+	for _, p := range payments {
+		if p.HasTag(strings.TrimPrefix(tag, "#")) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+func FilterPaymentsByMinAmount(payments []*Payment, minAmount float64) []*Payment {
+	if minAmount <= 0 {
+		return payments
+	}
+	found := []*Payment{}
+	for _, p := range payments {
+		if p.hasAmount && p.amount < minAmount {
+			continue
+		}
+		found = append(found, p)
+	}
+	return found
+}
+
+// SheetReader fetches the rows of one or more sheets of a spreadsheet
+type SheetReader interface {
+	// Read returns the rows of each requested sheet keyed by sheet name
+	Read(spreadsheetId string, sheetNames ...string) (map[string][][]interface{}, error)
+	// List returns the names of all the sheets in a spreadsheet
+	List(spreadsheetId string) ([]string, error)
+}
+
+// Readers holds the sheet reader of each source
+type Readers struct {
+	Google SheetReader
+	// google readers of the sheets with their own credentials
+	GoogleByCredentials map[string]SheetReader
+	CSV                 SheetReader
+	XLSX                SheetReader
+}
+
+// loggingSheetReader is a reader whose log lines (e.g. of retries) can be
+// written to another logger (e.g. the one of a run)
+type loggingSheetReader interface {
+	WithLogger(logger *log.Logger) SheetReader
+}
+
+// WithLogger returns a copy of the readers whose log lines are written to
+// logger (the readers that do not log are kept as they are)
+func (r *Readers) WithLogger(logger *log.Logger) *Readers {
+	withLogger := func(reader SheetReader) SheetReader {
+		if l, ok := reader.(loggingSheetReader); ok {
+			return l.WithLogger(logger)
+		}
+		return reader
+	}
+	readers := *r
+	readers.Google = withLogger(r.Google)
+	readers.CSV = withLogger(r.CSV)
+	readers.XLSX = withLogger(r.XLSX)
+	readers.GoogleByCredentials = map[string]SheetReader{}
+	for key, reader := range r.GoogleByCredentials {
+		readers.GoogleByCredentials[key] = withLogger(reader)
+	}
+	return &readers
+}
+
+// NewReaders creates the readers required by the config's sheets; google
+// credentials are only parsed for the google sheets that use them
+func NewReaders(config *Config) (*Readers, error) {
+	client, err := NewHTTPClient(config.HTTPProxy, config.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	readers := &Readers{
+		GoogleByCredentials: map[string]SheetReader{},
+		CSV:                 &CSVSheetReader{},
+		XLSX:                &XLSXSheetReader{},
+	}
+	for _, sheet := range config.Sheets {
+		if sheet.Source != SourceGoogle {
+			continue
+		}
+		key := sheet.CredentialsKey()
+		if key == "" {
+			if readers.Google == nil {
+				reader, err := NewGoogleSheetReaderFromJSON(config.Credentials, config.SheetReadAttempts, client)
+				if err != nil {
+					return nil, err
+				}
+				readers.Google = reader
+			}
+			continue
+		}
+		if _, ok := readers.GoogleByCredentials[key]; ok {
+			continue
+		}
+		credentials, err := sheetCredentials(sheet)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := NewGoogleSheetReaderFromJSON(credentials, config.SheetReadAttempts, client)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", sheet.Name, err)
+		}
+		readers.GoogleByCredentials[key] = reader
+	}
+	return readers, nil
+}
+
+// sheetCredentials returns the sheet's own (inline or file) credentials
+func sheetCredentials(sheet *Sheet) (string, error) {
+	if sheet.CredentialsFile == "" {
+		return sheet.Credentials, nil
+	}
+	contents, err := os.ReadFile(sheet.CredentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials of sheet %s: %v", sheet.Name, err)
+	}
+	return string(contents), nil
+}
+
+// For returns the reader of the sheet's source (and credentials)
+func (r *Readers) For(sheet *Sheet) SheetReader {
+	if sheet.Source == SourceCSV {
+		return r.CSV
+	}
+	if sheet.Source == SourceXLSX {
+		return r.XLSX
+	}
+	if key := sheet.CredentialsKey(); key != "" {
+		return r.GoogleByCredentials[key]
+	}
+	return r.Google
+}
+
+// WriterFor returns the writer of the (google) spreadsheet or nil if none
+// of the sheets belongs to the spreadsheet
+func (r *Readers) WriterFor(sheets []*Sheet, spreadsheetId string) SheetWriter {
+	for _, sheet := range sheets {
+		if sheet.Source == SourceGoogle && sheet.SpreadsheetId == spreadsheetId {
+			if writer, ok := r.For(sheet).(SheetWriter); ok {
+				return writer
+			}
+		}
+	}
+	return nil
+}
+
+// GoogleSheetReader reads sheets using the google sheets api
+type GoogleSheetReader struct {
+	svc      *sheets.Service
+	attempts int
+	backoff  time.Duration
+	// re-creates svc (e.g. after its token has expired)
+	newService func() (*sheets.Service, error)
+	// the rows read per request (DefaultSheetChunkRows if not set)
+	chunkRows int
+	// where retries are logged (the standard logger if not set)
+	logger *log.Logger
+}
+
+// WithLogger returns a copy of the reader that logs its retries to logger
+func (r *GoogleSheetReader) WithLogger(logger *log.Logger) SheetReader {
+	reader := *r
+	reader.logger = logger
+	return &reader
+}
+
+// log returns the logger of the reader
+func (r *GoogleSheetReader) log() *log.Logger {
+	if r.logger == nil {
+		return log.Default()
+	}
+	return r.logger
+}
+
+// DefaultSheetChunkRows is the number of rows read from a sheet per request;
+// larger sheets are read in chunks to stay within the api's response limits
+const DefaultSheetChunkRows = 5000
+
+// NewGoogleSheetReaderFromJSON creates a reader using a service account key
+func NewGoogleSheetReaderFromJSON(credentials string, attempts int, client *http.Client) (*GoogleSheetReader, error) {
+	jwtcfg, err := google.JWTConfigFromJSON([]byte(credentials), sheets.SpreadsheetsScope)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
+	}
+	return NewGoogleSheetReader(jwtcfg, attempts, client)
+}
+
+// NewGoogleSheetReader creates a reader whose (token and api) requests are
+// sent using client
+func NewGoogleSheetReader(jwtcfg *jwt.Config, attempts int, client *http.Client) (*GoogleSheetReader, error) {
+	newService := func() (*sheets.Service, error) {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		svc, err := sheets.NewService(ctx, option.WithHTTPClient(jwtcfg.Client(ctx)))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to retrieve Sheets Client: %v", err)
+		}
+		return svc, nil
+	}
+	svc, err := newService()
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleSheetReader{svc: svc, attempts: attempts, backoff: time.Second, newService: newService}, nil
+}
+
+// do calls fn (with retries) and, if it fails with an auth error (e.g. due
+// to an expired token), re-creates the service and calls fn once more
+func (r *GoogleSheetReader) do(fn func() error) error {
+	err := withRetry(r.log(), r.attempts, r.backoff, fn)
+	if !isAuthError(err) || r.newService == nil {
+		return err
+	}
+	r.log().Printf("re-creating sheets service after auth error: %v", err)
+	svc, svcErr := r.newService()
+	if svcErr != nil {
+		return fmt.Errorf("%v (failed to re-create sheets service: %v)", err, svcErr)
+	}
+	r.svc = svc
+	return withRetry(r.log(), r.attempts, r.backoff, fn)
+}
+
+// isAuthError is true for rejected credentials (401/403) and token failures
+func isAuthError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden
+	}
+	var tokenErr *oauth2.RetrieveError
+	return errors.As(err, &tokenErr)
+}
+
+// Read fetches all the requested sheets in a single api call
+func (r *GoogleSheetReader) Read(spreadsheetId string, sheetNames ...string) (map[string][][]interface{}, error) {
+	chunk := r.chunkRows
+	if chunk <= 0 {
+		chunk = DefaultSheetChunkRows
+	}
+	ranges := []string{}
+	for _, name := range sheetNames {
+		ranges = append(ranges, sheetRange(name, 1, chunk))
+	}
+	valueRanges, err := r.batchGet(spreadsheetId, ranges)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][][]interface{}{}
+	// the sheets whose grid extends beyond the first chunk
+	more := []string{}
+	for idx, name := range sheetNames {
+		values[name] = valueRanges[idx].Values
+		if lastRow(valueRanges[idx].Range) >= chunk {
+			more = append(more, name)
+		}
+	}
+	if len(more) == 0 {
+		return values, nil
+	}
+
+	rowCounts, err := r.rowCounts(spreadsheetId)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range more {
+		for from := chunk + 1; from <= rowCounts[name]; from += chunk {
+			to := from + chunk - 1
+			if to > rowCounts[name] {
+				to = rowCounts[name]
+			}
+			valueRanges, err := r.batchGet(spreadsheetId, []string{sheetRange(name, from, to)})
+			if err != nil {
+				return nil, err
+			}
+			rows := valueRanges[0].Values
+			if len(rows) == 0 {
+				continue
+			}
+			// trailing empty rows are omitted so the rows read so far are
+			// padded to keep the rows in place (i.e. at their row number)
+			for len(values[name]) < from-1 {
+				values[name] = append(values[name], []interface{}{})
+			}
+			values[name] = append(values[name], rows...)
+		}
+	}
+	return values, nil
+}
+
+// batchGet reads the ranges of the spreadsheet
+func (r *GoogleSheetReader) batchGet(spreadsheetId string, ranges []string) ([]*sheets.ValueRange, error) {
+	var res *sheets.BatchGetValuesResponse
+	err := r.do(func() (err error) {
+		// numbers and dates are read unformatted (dates as serial numbers)
+		// so that their values do not depend on the sheet's locale
+		res, err = r.svc.Spreadsheets.Values.BatchGet(spreadsheetId).Ranges(ranges...).
+			ValueRenderOption("UNFORMATTED_VALUE").DateTimeRenderOption("SERIAL_NUMBER").Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// value ranges are returned in the same order as the requested ranges
+	if len(res.ValueRanges) != len(ranges) {
+		return nil, fmt.Errorf("expected %d value ranges, got %d", len(ranges), len(res.ValueRanges))
+	}
+	return res.ValueRanges, nil
+}
+
+// rowCounts returns the number of rows of the grid of each sheet
+func (r *GoogleSheetReader) rowCounts(spreadsheetId string) (map[string]int, error) {
+	var res *sheets.Spreadsheet
+	err := r.do(func() (err error) {
+		res, err = r.svc.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties(title,gridProperties.rowCount)").Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, sheet := range res.Sheets {
+		if sheet.Properties.GridProperties != nil {
+			counts[sheet.Properties.Title] = int(sheet.Properties.GridProperties.RowCount)
+		}
+	}
+	return counts, nil
+}
+
+// sheetRange returns the range of the rows of a sheet in A1 notation
+func sheetRange(name string, from, to int) string {
+	return fmt.Sprintf("%s!%d:%d", quoteSheetName(name), from, to)
+}
+
+// quoteSheetName quotes a sheet name for A1 notation so that names with
+// spaces or special characters (e.g. "Q1 2024" or "John's Bills") are not
+// mistaken for ranges; quotes in the name are escaped by doubling them
+func quoteSheetName(name string) string {
+	return "'" + strings.ReplaceAll(name, "'", "''") + "'"
+}
+
+// lastRow returns the last row of a range in A1 notation (e.g. 20 for
+// Sheet1!A1:D20) or 0 if it has none
+func lastRow(a1 string) int {
+	cells := a1[strings.LastIndex(a1, "!")+1:]
+	end := cells[strings.LastIndex(cells, ":")+1:]
+	row, err := strconv.Atoi(strings.TrimLeft(end, "ABCDEFGHIJKLMNOPQRSTUVWXYZ$"))
+	if err != nil {
+		return 0
+	}
+	return row
+}
+
+// MaxRetryDelay is the longest wait between two attempts of a request; the
+// doubled backoff stops growing there and requests asked to wait longer
+// (using Retry-After) are not retried
+const MaxRetryDelay = 30 * time.Second
+
+// withRetry calls fn until it succeeds, fails with a non-retryable error or
+// runs out of attempts, doubling the backoff between consecutive attempts
+// (the failed attempts are logged to logger)
+func withRetry(logger *log.Logger, attempts int, backoff time.Duration, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		delay, retryable := retryDelay(err, backoff)
+		if !retryable || attempt >= attempts {
+			return err
+		}
+		logger.Printf("attempt %d/%d failed (retrying in %v): %v", attempt, attempts, delay, err)
+		time.Sleep(delay)
+		backoff *= 2
+		if backoff > MaxRetryDelay {
+			backoff = MaxRetryDelay
+		}
+	}
+}
+
+// retryDelay determines whether err is transient and how long to wait
+// before retrying (429 responses may specify that using Retry-After, in
+// which case waits longer than MaxRetryDelay are not retried)
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		// not an api response (e.g. a network failure)
+		return backoff, true
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		if seconds, err := strconv.Atoi(apiErr.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay := time.Duration(seconds) * time.Second
+			return delay, delay <= MaxRetryDelay
+		}
+		return backoff, true
+	case apiErr.Code >= 500:
+		return backoff, true
+	}
+	return 0, false
+}
+
+// MarkPaid writes the payment date to the cell (as if typed by the user so
+// that it is parsed as a date)
+func (r *GoogleSheetReader) MarkPaid(cell *PaidCell, date string) error {
+	values := &sheets.ValueRange{Values: [][]interface{}{{date}}}
+	return r.do(func() error {
+		_, err := r.svc.Spreadsheets.Values.Update(cell.SpreadsheetId, cell.Range(), values).ValueInputOption("USER_ENTERED").Do()
+		return err
+	})
+}
+
+// List enumerates the spreadsheet's tabs
+func (r *GoogleSheetReader) List(spreadsheetId string) ([]string, error) {
+	var res *sheets.Spreadsheet
+	err := r.do(func() (err error) {
+		res, err = r.svc.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties.title").Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, sheet := range res.Sheets {
+		names = append(names, sheet.Properties.Title)
+	}
+	return names, nil
+}
+
+// ExpandSheets replaces the sheets named "*" with one sheet per (non-excluded)
+// tab of the corresponding spreadsheet
+func ExpandSheets(readers *Readers, sheets []*Sheet) ([]*Sheet, error) {
+	expanded := []*Sheet{}
+	for _, sheet := range sheets {
+		if sheet.Name != AllSheets {
+			expanded = append(expanded, sheet)
+			continue
+		}
+		names, err := readers.For(sheet).List(sheet.Location())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sheets of spreadsheet %s: %v", sheet.Location(), err)
+		}
+		for _, name := range names {
+			if sheet.Exclude != "" {
+				if excluded, _ := path.Match(sheet.Exclude, name); excluded {
+					continue
+				}
+			}
+			tab := *sheet
+			tab.Name = name
+			expanded = append(expanded, &tab)
+		}
+	}
+	return expanded, nil
+}
+
+func readSheet(readers *Readers, sheet *Sheet) ([][]interface{}, error) {
+	values, err := readers.For(sheet).Read(sheet.Location(), sheet.Name)
+	if err != nil {
+		return nil, err
+	}
+	rows := values[sheet.Name]
+	if len(rows) <= sheet.HeaderRow+1 {
+		return nil, ErrNoData
+	}
+	return rows, nil
+}
+
+// GroupSheetsBySpreadsheet groups sheets by source and location (e.g. the
+// spreadsheet id) in order of appearance
+func GroupSheetsBySpreadsheet(sheets []*Sheet) [][]*Sheet {
+	groups := [][]*Sheet{}
+	index := map[string]int{}
+	for _, sheet := range sheets {
+		key := sheet.Source + ":" + sheet.Location() + ":" + sheet.CredentialsKey()
+		idx, ok := index[key]
+		if !ok {
+			idx = len(groups)
+			index[key] = idx
+			groups = append(groups, []*Sheet{})
+		}
+		groups[idx] = append(groups[idx], sheet)
+	}
+	return groups
+}
+
+// errors returned when reading sheets (wrapped with more context)
+var (
+	ErrNoData            = errors.New("no data found")
+	ErrMissingHeader     = errors.New("missing header")
+	ErrDuplicateHeader   = errors.New("duplicate header")
+	ErrUnparseableDate   = errors.New("unparseable date")
+	ErrUnparseableAmount = errors.New("unparseable amount")
+	ErrInvalidLeadDays   = errors.New("invalid lead days")
+)
+
+// readPayments returns the pending payments of the sheet
+func readPayments(rows [][]interface{}, sheet *Sheet, now time.Time) ([]*Payment, error) {
+	payments, _, err := readSheetPayments(rows, sheet, now, log.Default())
+	return payments, err
+}
+
+// readSheetPayments returns the pending payments of the sheet along with the
+// paid ones (with their payment date in paidOn, if it can be parsed) and
+// logs the issues that do not fail the sheet to logger
+func readSheetPayments(rows [][]interface{}, sheet *Sheet, now time.Time, logger *log.Logger) ([]*Payment, []*Payment, error) {
+	descriptionIndex := -1
+	dueDateIndex := -1
+	paymentDateIndex := -1
+	amountIndex := -1
+	optionalIndex := -1
+	categoryIndex := -1
+	leadDaysIndex := -1
+	currencyIndex := -1
+	dateIndex := -1
+	statusIndex := -1
+	if sheet.HeaderRow >= len(rows) {
+		return nil, nil, fmt.Errorf("%w: header row %d is beyond the sheet's %d rows", ErrMissingHeader, sheet.HeaderRow, len(rows))
+	}
+	// the first column of each label is used (duplicates are reported)
+	duplicates := []string{}
+	useColumn := func(index *int, idx int, label string) {
+		if *index == -1 {
+			*index = idx
+		} else {
+			duplicates = append(duplicates, fmt.Sprintf("%s (columns %d and %d)", label, *index+1, idx+1))
+		}
+	}
+	for idx, v := range rows[sheet.HeaderRow] {
+		// empty (e.g. merged) header cells are skipped
+		val, _ := v.(string)
+		val = strings.TrimSpace(val)
+		if val == "Description" {
+			useColumn(&descriptionIndex, idx, val)
+		}
+		if val == "Due Date" {
+			useColumn(&dueDateIndex, idx, val)
+		}
+		if val == sheet.PaymentDateLabel() {
+			useColumn(&paymentDateIndex, idx, val)
+		}
+		if val == "Amount" {
+			useColumn(&amountIndex, idx, val)
+		}
+		if val == "Optional" {
+			useColumn(&optionalIndex, idx, val)
+		}
+		if val == "Category" {
+			useColumn(&categoryIndex, idx, val)
+		}
+		if val == "Currency" {
+			useColumn(&currencyIndex, idx, val)
+		}
+		if val == "Lead Days" {
+			useColumn(&leadDaysIndex, idx, val)
+		}
+		if sheet.DateColumn != "" && val == sheet.DateColumn {
+			useColumn(&dateIndex, idx, val)
+		}
+		if sheet.StatusColumn != "" && val == sheet.StatusColumn {
+			useColumn(&statusIndex, idx, val)
+		}
+	}
+	if len(duplicates) > 0 {
+		if sheet.strictHeaders {
+			return nil, nil, fmt.Errorf("%w: %s", ErrDuplicateHeader, strings.Join(duplicates, ", "))
+		}
+		logger.Printf("sheet %s: duplicate header labels %s (using the first of each)", sheet.Name, strings.Join(duplicates, ", "))
+	}
+	if descriptionIndex == -1 {
+		return nil, nil, fmt.Errorf("%w: description label was not found in sheet header", ErrMissingHeader)
+	}
+	if paymentDateIndex == -1 && sheet.StatusColumn == "" {
+		return nil, nil, fmt.Errorf("%w: payment date column %s was not found in sheet header", ErrMissingHeader, sheet.PaymentDateLabel())
+	}
+	if sheet.StatusColumn != "" && statusIndex == -1 {
+		return nil, nil, fmt.Errorf("%w: status column %s was not found in sheet header", ErrMissingHeader, sheet.StatusColumn)
+	}
+	if sheet.DateColumn != "" && dateIndex == -1 {
+		return nil, nil, fmt.Errorf("%w: date column %s was not found in sheet header", ErrMissingHeader, sheet.DateColumn)
+	}
+
+	payments, paid := []*Payment{}, []*Payment{}
+	var (
+		err     error
+		due     time.Time
+		dueDate string
+	)
+
+	for idx, row := range rows[sheet.HeaderRow+1:] {
+		// rows are numbered as in the sheet (i.e. starting from 1)
+		rowNumber := sheet.HeaderRow + idx + 2
+		if descriptionIndex > len(row)-1 {
+			// this means that there is no description
+			// we will consider the row as being empty and skip it
+			continue
+		}
+
+		description, tags := parseTags(cellValue(row, descriptionIndex))
+
+		// trailing empty cells are omitted by the api so we treat them as empty
+		dueDate = dateCellValue(row, dueDateIndex)
+		if paymentDate := dateCellValue(row, paymentDateIndex); paymentDate != "" {
+			// already paid -- kept apart from the pending payments
+			payment := NewPayment(description).WithTags(tags...)
+			payment.sheet = sheet.Name
+			payment.paidOn, _ = parsePaidDate(strings.TrimSpace(paymentDate))
+			paid = append(paid, payment.WithCategory(strings.TrimSpace(cellValue(row, categoryIndex))))
+			continue
+		}
+		if status := strings.TrimSpace(cellValue(row, statusIndex)); status != "" {
+			if hasStatus(sheet.PaidStatuses, status) || hasStatus(sheet.SkipStatuses, status) {
+				// paid or otherwise settled (e.g. cancelled) -- skip
+				continue
+			}
+		}
+		if sheet.ackPrefix != "" && strings.HasPrefix(strings.TrimSpace(description), sheet.ackPrefix) {
+			// acknowledged (handled but not yet recorded as paid) -- skip
+			continue
+		}
+		payment := NewPayment(description).WithTags(tags...)
+		payment.sheet = sheet.Name
+		if sheet.Source == SourceGoogle {
+			payment.spreadsheetId = sheet.SpreadsheetId
+		}
+		if sheet.descriptionStrip != nil {
+			// keep the original description if nothing is left
+			if stripped := strings.TrimSpace(sheet.descriptionStrip.ReplaceAllString(description, "")); stripped != "" {
+				payment.WithDisplayDescription(stripped)
+			}
+		}
+		if sheet.Type == SheetTypePriority {
+			payment.AsPriority()
+		}
+		if sheet.Source == SourceGoogle && paymentDateIndex != -1 {
+			payment.paidCell = &PaidCell{SpreadsheetId: sheet.SpreadsheetId, Sheet: sheet.Name, Cell: columnName(paymentDateIndex) + strconv.Itoa(rowNumber)}
+		}
+		// the amount column is optional and so are its values (which are
+		// numbers unless they are entered as text)
+		if amount, ok := numberCellValue(row, amountIndex); ok {
+			payment.WithAmount(amount)
+		} else if amount := strings.TrimSpace(cellValue(row, amountIndex)); amount != "" {
+			value, currency, err := parseAmount(amount, sheet.DecimalSeparator)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: failed to parse amount value %s for %s in row %d: %v", ErrUnparseableAmount, amount, description, rowNumber, err)
+			}
+			payment.WithAmount(value).WithCurrency(currency)
+		}
+		if isTruthy(cellValue(row, optionalIndex)) {
+			payment.AsOptional()
+		}
+		payment.WithCategory(strings.TrimSpace(cellValue(row, categoryIndex)))
+		if lead := strings.TrimSpace(cellValue(row, leadDaysIndex)); lead != "" {
+			days, err := strconv.Atoi(lead)
+			if err != nil || days < 0 {
+				return nil, nil, fmt.Errorf("%w: value %s for %s in row %d", ErrInvalidLeadDays, lead, description, rowNumber)
+			}
+			payment.WithLeadDays(days)
+		}
+		// the currency column takes precedence over the amount's symbol
+		if currency := strings.TrimSpace(cellValue(row, currencyIndex)); currency != "" {
+			payment.WithCurrency(currency)
+		}
+		if dueDateIndex == -1 && dateIndex == -1 {
+			// not a scheduled payment -- add to payments and continue
+			payments = append(payments, payment)
+			continue
+		}
+		if strings.TrimSpace(dueDate) == "" && dateIndex >= 0 && strings.TrimSpace(dateCellValue(row, dateIndex)) != "" {
+			// scheduled payment -- due a number of days after the date column
+			date := dateCellValue(row, dateIndex)
+			if due, err = parseDueDate(date, now); err != nil {
+				return nil, nil, fmt.Errorf("%w: failed to parse %s value %s: %v", ErrUnparseableDate, sheet.DateColumn, date, err)
+			}
+			payments = append(payments, payment.WithDueDate(due.AddDate(0, 0, sheet.NetDays)))
+			continue
+		}
+		if strings.TrimSpace(dueDate) == "" {
+			// a blank due cell -- not a scheduled payment (rather than one
+			// due at the zero time)
+			payments = append(payments, payment)
+			continue
+		}
+		// scheduled payment -- parse due date (and time)
+		if due, ok := parseDueTime(dueDate); ok {
+			payments = append(payments, payment.WithDueTime(due))
+			continue
+		}
+		if due, err = parseDueDate(dueDate, now); err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to parse due date value %s: %v", ErrUnparseableDate, dueDate, err)
+		}
+		payments = append(payments, payment.WithDueDate(due))
+	}
+	return payments, paid, nil
+}
+
+// parseTags extracts the hashtags (e.g. "Rent #housing") from a description
+// and returns the description without them
+func parseTags(description string) (string, []string) {
+	words := []string{}
+	tags := []string{}
+	for _, word := range strings.Fields(description) {
+		if len(word) > 1 && strings.HasPrefix(word, "#") {
+			tags = append(tags, word[1:])
+		} else {
+			words = append(words, word)
+		}
+	}
+	if len(tags) == 0 {
+		return description, tags
+	}
+	return strings.Join(words, " "), tags
+}
+
+// parseDueDate parses a due date or resolves a relative due date keyword
+// (eom, eom-1, today, next-friday) against now
+func parseDueDate(value string, now time.Time) (time.Time, error) {
+	today := ToDate(now.In(GreekTimeZone()))
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "today":
+		return today, nil
+	case "eom":
+		return today.AddDate(0, 1, -today.Day()), nil
+	case "eom-1":
+		return today.AddDate(0, 1, -today.Day()-1), nil
+	case "next-friday":
+		days := (int(time.Friday) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// parsePaidDate parses the value of a payment date cell (a date, optionally
+// with a time); ok is false for other (e.g. "x") values
+func parsePaidDate(value string) (paidOn time.Time, ok bool) {
+	for _, layout := range append([]string{time.DateOnly}, dueTimeLayouts...) {
+		if t, err := time.ParseInLocation(layout, value, GreekTimeZone()); err == nil {
+			return ToDate(t), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dueTimeLayouts are the accepted layouts of due dates with a cutoff time
+var dueTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"}
+
+// hasStatus reports whether status is one of statuses (ignoring case)
+func hasStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if strings.EqualFold(strings.TrimSpace(s), status) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDueTime parses a due date that includes a time component; times
+// without a zone are in the greek time zone
+func parseDueTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dueTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, GreekTimeZone()); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseAmount parses an amount that may be preceded or followed by a
+// currency symbol (or code) and may contain thousands separators; the
+// currency found in the value (if any) is returned along with the amount
+// and a minus may come before or after a leading currency (e.g. "-€5" or
+// "€-5")
+func parseAmount(value, decimalSeparator string) (float64, string, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimFunc(value, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.' && r != ','
+	})
+	if number == "" {
+		return 0, "", errors.New("no digits found")
+	}
+	start := strings.Index(value, number)
+	prefix, suffix := strings.TrimSpace(value[:start]), value[start+len(number):]
+	sign := ""
+	if strings.HasPrefix(prefix, "-") {
+		sign, prefix = "-", prefix[1:]
+	} else if strings.HasSuffix(prefix, "-") {
+		sign, prefix = "-", prefix[:len(prefix)-1]
+	}
+	currency := strings.TrimSpace(prefix + suffix)
+	if decimalSeparator == "" {
+		decimalSeparator = DefaultDecimalSeparator
+	}
+	thousandsSeparator := ","
+	if decimalSeparator == "," {
+		thousandsSeparator = "."
+	}
+	// spaces and apostrophes are also used as thousands separators
+	number = strings.NewReplacer(" ", thousandsSeparator, "\u00a0", thousandsSeparator, "'", thousandsSeparator).Replace(number)
+	integer, fraction, _ := strings.Cut(number, decimalSeparator)
+	if strings.Contains(fraction, thousandsSeparator) {
+		return 0, "", fmt.Errorf("%q found after the decimal separator %q", thousandsSeparator, decimalSeparator)
+	}
+	if groups := strings.Split(integer, thousandsSeparator); len(groups) > 1 {
+		for idx, group := range groups {
+			if len(group) != 3 && (idx > 0 || len(group) == 0 || len(group) > 3) {
+				return 0, "", fmt.Errorf("invalid thousands grouping in %q", number)
+			}
+		}
+	}
+	number = strings.ReplaceAll(integer, thousandsSeparator, "") + "." + fraction
+	amount, err := strconv.ParseFloat(sign+number, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return amount, currency, nil
+}
+
+// isTruthy interprets a cell value (e.g. a checkbox) as a boolean
+func isTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "y", "x", "1":
+		return true
+	}
+	return false
+}
+
+// cellValue returns the string value of the row's cell at idx or an empty
+// string if the column is absent or the row is shorter than the header
+func cellValue(row []interface{}, idx int) string {
+	if idx < 0 || idx > len(row)-1 {
+		return ""
+	}
+	if value, ok := row[idx].(string); ok || row[idx] == nil {
+		return value
+	}
+	// e.g. numbers and booleans of unformatted values
+	return fmt.Sprint(row[idx])
+}
+
+// numberCellValue returns the value of the row's cell at idx if it is a
+// number (rather than text)
+func numberCellValue(row []interface{}, idx int) (float64, bool) {
+	if idx < 0 || idx > len(row)-1 {
+		return 0, false
+	}
+	value, ok := row[idx].(float64)
+	return value, ok
+}
+
+// SerialDateEpoch is day zero of the serial numbers of spreadsheet dates;
+// it is 1899-12-30 (rather than 1899-12-31) to make up for 1900 being
+// counted as a leap year by the serial numbers of the early days
+var SerialDateEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// dateCellValue is the value of a date cell which may also be a serial
+// number (e.g. of cells formatted as dates) -- serial numbers are
+// formatted as dates (along with the time of day if they have one)
+func dateCellValue(row []interface{}, idx int) string {
+	if idx < 0 || idx > len(row)-1 {
+		return ""
+	}
+	serial, ok := row[idx].(float64)
+	if !ok {
+		return cellValue(row, idx)
+	}
+	t := serialToTime(serial)
+	if t.Hour() == 0 && t.Minute() == 0 {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// serialToTime converts a serial number (days since SerialDateEpoch with
+// the fraction being the time of day) to a time (rounded to the minute)
+func serialToTime(serial float64) time.Time {
+	days := math.Floor(serial)
+	minutes := math.Round((serial - days) * 24 * 60)
+	return SerialDateEpoch.AddDate(0, 0, int(days)).Add(time.Duration(minutes) * time.Minute)
+}
+
+const MaxNtfyActions = 3
+
+// the summaries of sections with nothing to report
+const (
+	NothingToReport = "🕶  Nothing to report"
+	NothingForToday = "😎 Nothing for today"
+	NothingComingUp = "😎 Nothing coming up"
+	NothingThisWeek = "😎 Nothing due this week"
+)
+
+// IsEmptyReport reports whether none of the sections (apart from the total
+// which is always there) has something to report
+func IsEmptyReport(sections []*ReportSection) bool {
+	for _, section := range sections {
+		if section.Key != SectionTotal && !section.HasNothing() {
+			return false
+		}
+	}
+	return true
+}
+
+// HasNothing is true for the sections with nothing to report
+func (s *ReportSection) HasNothing() bool {
+	switch s.Text {
+	case NothingToReport, NothingForToday, NothingComingUp, NothingThisWeek:
+		return true
+	}
+	return false
+}
+
+const (
+	PriorityDefault = 0
+	PriorityHigh    = 4
+	PriorityUrgent  = 5
+)
+
+// OverduePriority maps the most overdue payment to an ntfy priority
+func OverduePriority(payments []*Payment, now time.Time) int {
+	maxOverdue := 0
+	for _, p := range FindPaymentsUntil(payments, -1, now) {
+		if overdue := -p.DiffFromNowInDays(now); overdue > maxOverdue {
+			maxOverdue = overdue
+		}
+	}
+	if maxOverdue > 7 {
+		return PriorityUrgent
+	}
+	if maxOverdue >= 1 {
+		return PriorityHigh
+	}
+	return PriorityDefault
+}
+
+// Notifier delivers a notification to the user
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// NewHTTPClient creates the client of all outbound requests; requests go
+// through proxy if set or else through the proxy of the standard env vars
+// (HTTPS_PROXY, HTTP_PROXY and NO_PROXY) and carry the user agent (if set)
+func NewHTTPClient(proxy, userAgent string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if userAgent == "" {
+		return &http.Client{Transport: transport}, nil
+	}
+	return &http.Client{Transport: &userAgentTransport{userAgent: userAgent, base: transport}}, nil
+}
+
+// DefaultUserAgent identifies the application (and its version)
+func DefaultUserAgent() string {
+	return "remindme/" + Version
+}
+
+// userAgentTransport sets the User-Agent of the requests (replacing the
+// one of the google api client)
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// round trippers must not modify the original request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// DefaultNtfyServer is the ntfy server notifications are published to
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// NtfyNotifier publishes notifications to ntfy.sh
+type NtfyNotifier struct {
+	Client *http.Client
+	// the url of the ntfy server (defaults to DefaultNtfyServer)
+	Server string
+}
+
+func (nn *NtfyNotifier) Notify(n *Notification) error {
+	client := nn.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	server := nn.Server
+	if server == "" {
+		server = DefaultNtfyServer
+	}
+	return SendNotification(client, server, n)
+}
+
+// ReportTag returns the urgent tag when payments are delayed or due by
+// tomorrow and the neutral tag otherwise
+func ReportTag(config *Config, payments []*Payment, now time.Time) string {
+	if len(FindPaymentsUntil(payments, 1, now)) > 0 {
+		return config.UrgentTag
+	}
+	return config.NeutralTag
+}
+
+type Notification struct {
+	Topic   string
+	Title   string
+	Message string
+	Tags    string
+	// the ntfy priority (1-5) -- left unset when zero
+	Priority int
+	// the url opened when the notification is clicked
+	Click string
+	// the notification's action buttons (in ntfy's short format)
+	Actions string
+	// forward the notification to this email address and/or phone number
+	Email string
+	Call  string
+	// a file attached to the notification (the message is then sent as a
+	// header since the attachment is the body of the request)
+	Attachment []byte
+	Filename   string
+}
+
+func SendNotification(client *http.Client, server string, n *Notification) error {
+	req, err := newNotificationRequest(server, n)
+	if err != nil {
+		return fmt.Errorf("failed to create http request: %v", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending http request: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server responded with status=%d", res.StatusCode)
+	}
+	return nil
+}
+
+func newNotificationRequest(server string, n *Notification) (*http.Request, error) {
+	host := fmt.Sprintf("%s/%s", strings.TrimSuffix(server, "/"), n.Topic)
+	if n.Attachment != nil {
+		// ntfy attaches the body of PUT requests as the file
+		req, err := http.NewRequest(http.MethodPut, host, bytes.NewReader(n.Attachment))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Filename", n.Filename)
+		// headers are ascii so the message is encoded (RFC 2047)
+		req.Header.Set("Message", mime.BEncoding.Encode("UTF-8", n.Message))
+		setNotificationHeaders(req, n)
+		return req, nil
+	}
+	req, err := http.NewRequest(http.MethodPost, host, strings.NewReader(n.Message))
+	if err != nil {
+		return nil, err
+	}
+	setNotificationHeaders(req, n)
+	return req, nil
+}
+
+func setNotificationHeaders(req *http.Request, n *Notification) {
+	req.Header.Set("Title", n.Title)
+	req.Header.Set("Tags", n.Tags)
+	if n.Priority != PriorityDefault {
+		req.Header.Set("Priority", strconv.Itoa(n.Priority))
+	}
+	if n.Click != "" {
+		req.Header.Set("Click", n.Click)
+	}
+	if n.Actions != "" {
+		req.Header.Set("Actions", n.Actions)
+	}
+	if n.Email != "" {
+		req.Header.Set("Email", n.Email)
+	}
+	if n.Call != "" {
+		req.Header.Set("Call", n.Call)
 	}
-	return nil
 }
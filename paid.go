@@ -0,0 +1,215 @@
+package remindme
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PaidCell is the payment date cell of a payment in its (google) sheet
+type PaidCell struct {
+	SpreadsheetId string
+	Sheet         string
+	// in A1 notation (e.g. C5)
+	Cell string
+}
+
+// Range returns the cell's range in A1 notation (including the sheet)
+func (c *PaidCell) Range() string {
+	return quoteSheetName(c.Sheet) + "!" + c.Cell
+}
+
+// SheetWriter writes the payment date of a payment back to its sheet
+type SheetWriter interface {
+	MarkPaid(cell *PaidCell, date string) error
+}
+
+// columnName converts a (zero-based) column index to its A1 name
+func columnName(idx int) string {
+	name := ""
+	for idx >= 0 {
+		name = string(rune('A'+idx%26)) + name
+		idx = idx/26 - 1
+	}
+	return name
+}
+
+// PaidButtonTTL is how long the "Paid" buttons of a notification work
+const PaidButtonTTL = 7 * 24 * time.Hour
+
+// PaidRequest is the request of a "Paid" button to mark the payment of a
+// cell as paid; the payment is identified by its (original) description
+// and due date so that the cell is only written if it still holds the
+// same payment (e.g. rows may have been inserted or sorted since)
+type PaidRequest struct {
+	Cell        *PaidCell
+	Description string
+	Due         string
+	Expires     time.Time
+}
+
+// NewPaidRequest creates the request of the payment's button
+func NewPaidRequest(p *Payment, expires time.Time) *PaidRequest {
+	return &PaidRequest{Cell: p.paidCell, Description: p.original, Due: p.dueDate(), Expires: expires}
+}
+
+// sign authenticates the request using the shared secret so that a
+// callback url can only be used for marking its own payment as paid (and
+// until it expires)
+func (r *PaidRequest) sign(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fields := []string{r.Cell.SpreadsheetId, r.Cell.Sheet, r.Cell.Cell, r.Description, r.Due, strconv.FormatInt(r.Expires.Unix(), 10)}
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the callback url of the request
+func (r *PaidRequest) URL(baseURL, secret string) string {
+	query := url.Values{}
+	query.Set("spreadsheet_id", r.Cell.SpreadsheetId)
+	query.Set("sheet", r.Cell.Sheet)
+	query.Set("cell", r.Cell.Cell)
+	query.Set("description", r.Description)
+	query.Set("due", r.Due)
+	query.Set("expires", strconv.FormatInt(r.Expires.Unix(), 10))
+	query.Set("signature", r.sign(secret))
+	return strings.TrimSuffix(baseURL, "/") + "/paid?" + query.Encode()
+}
+
+// parsePaidRequest reads the request of a callback url (and checks its
+// signature)
+func parsePaidRequest(query url.Values, secret string) (*PaidRequest, bool) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	req := &PaidRequest{
+		Cell:        &PaidCell{SpreadsheetId: query.Get("spreadsheet_id"), Sheet: query.Get("sheet"), Cell: query.Get("cell")},
+		Description: query.Get("description"),
+		Due:         query.Get("due"),
+		Expires:     time.Unix(expires, 0),
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	expected, _ := hex.DecodeString(req.sign(secret))
+	return req, err == nil && hmac.Equal(signature, expected)
+}
+
+// PaidActions returns up to max ntfy http actions (in the short format)
+// that mark the payments as paid using the callback server (until expires)
+func PaidActions(payments []*Payment, baseURL, secret string, expires time.Time, max int) []string {
+	actions := []string{}
+	for _, p := range payments {
+		if len(actions) >= max {
+			break
+		}
+		if p.paidCell == nil {
+			continue
+		}
+		// commas and semicolons separate the fields and actions
+		label := strings.NewReplacer(",", " ", ";", " ").Replace("Paid " + p.description)
+		actions = append(actions, fmt.Sprintf("http, %s, %s, method=POST, clear=true", label, NewPaidRequest(p, expires).URL(baseURL, secret)))
+	}
+	return actions
+}
+
+// PaymentAt reads the pending payment of a paid cell from its sheet (nil if
+// the row is not a pending payment, e.g. it has been paid already)
+func PaymentAt(readers *Readers, sheets []*Sheet, cell *PaidCell, now time.Time) (*Payment, error) {
+	var sheet *Sheet
+	for _, s := range sheets {
+		if s.Source != SourceGoogle || s.SpreadsheetId != cell.SpreadsheetId {
+			continue
+		}
+		if s.Name == cell.Sheet {
+			sheet = s
+			break
+		}
+		if s.Name == AllSheets && sheet == nil {
+			tab := *s
+			tab.Name = cell.Sheet
+			sheet = &tab
+		}
+	}
+	if sheet == nil {
+		return nil, nil
+	}
+	rows, err := readSheet(readers, sheet)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := readPayments(rows, sheet, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if p.paidCell != nil && p.paidCell.Cell == cell.Cell {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// PaidHandler marks payments as paid (by writing today's date to their
+// payment date cell) on behalf of the notification's action buttons
+type PaidHandler struct {
+	secret string
+	// the writer of the spreadsheet (nil if it can not be written)
+	writerFor func(spreadsheetId string) SheetWriter
+	// the pending payment of the cell as currently found in its sheet
+	lookup func(cell *PaidCell) (*Payment, error)
+	now    func() time.Time
+}
+
+func NewPaidHandler(secret string, writerFor func(spreadsheetId string) SheetWriter, lookup func(cell *PaidCell) (*Payment, error)) *PaidHandler {
+	return &PaidHandler{secret: secret, writerFor: writerFor, lookup: lookup, now: time.Now}
+}
+
+func (h *PaidHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := parsePaidRequest(r.URL.Query(), h.secret)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !h.now().Before(req.Expires) {
+		http.Error(w, "the button has expired", http.StatusGone)
+		return
+	}
+	cell := req.Cell
+	writer := h.writerFor(cell.SpreadsheetId)
+	if writer == nil {
+		http.Error(w, "unknown spreadsheet", http.StatusNotFound)
+		return
+	}
+	// the row has to hold the same (pending) payment as when the button
+	// was created
+	p, err := h.lookup(cell)
+	if err != nil {
+		log.Printf("failed to read %s: %v", cell.Range(), err)
+		http.Error(w, "failed to read sheet", http.StatusBadGateway)
+		return
+	}
+	if p == nil || p.original != req.Description || p.dueDate() != req.Due {
+		log.Printf("not marking %s as paid: it no longer holds the pending payment %s (due %s)", cell.Range(), req.Description, req.Due)
+		http.Error(w, "the payment has changed or has been paid already", http.StatusConflict)
+		return
+	}
+	date := h.now().In(GreekTimeZone()).Format(time.DateOnly)
+	if err := writer.MarkPaid(cell, date); err != nil {
+		log.Printf("failed to mark %s as paid: %v", cell.Range(), err)
+		http.Error(w, "failed to update sheet", http.StatusBadGateway)
+		return
+	}
+	log.Printf("marked %s as paid on %s", cell.Range(), date)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package remindme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSheetWriter struct {
+	paid map[string]string
+}
+
+func (w *fakeSheetWriter) MarkPaid(cell *PaidCell, date string) error {
+	w.paid[cell.Range()] = date
+	return nil
+}
+
+func Test_ColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "AZ", columnName(51))
+}
+
+func Test_PaidHandler(t *testing.T) {
+	reader := &fakeSheetReader{sheets: map[string]map[string][][]interface{}{
+		"abc": {"Bob's": {
+			{"Description", "Due Date", "Payment Date"},
+			{"rent", "2023-11-01", ""},
+			{"water", "2023-11-10", "2023-11-09"},
+			{"phone", "2023-11-20", ""},
+		}},
+	}}
+	sheets := []*Sheet{{SpreadsheetId: "abc", Name: "*", Source: SourceGoogle}}
+	now := time.Date(2023, time.November, 15, 9, 0, 0, 0, GreekTimeZone())
+	writer := &fakeSheetWriter{paid: map[string]string{}}
+	handler := NewPaidHandler("secret", func(spreadsheetId string) SheetWriter {
+		if spreadsheetId == "abc" {
+			return writer
+		}
+		return nil
+	}, func(cell *PaidCell) (*Payment, error) {
+		return PaymentAt(&Readers{Google: reader}, sheets, cell, now)
+	})
+	handler.now = func() time.Time { return now }
+	server := NewServer(time.Now).WithPaidHandler(handler)
+
+	post := func(target string) int {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, strings.TrimPrefix(target, "https://example.com"), nil))
+		return rec.Code
+	}
+	expires := now.Add(time.Hour)
+	request := func(cell, description, due string) *PaidRequest {
+		return &PaidRequest{Cell: &PaidCell{SpreadsheetId: "abc", Sheet: "Bob's", Cell: cell}, Description: description, Due: due, Expires: expires}
+	}
+	target := request("C2", "rent", "2023-11-01").URL("https://example.com/", "secret")
+
+	assert.Equal(t, http.StatusNoContent, post(target))
+	assert.Equal(t, map[string]string{"'Bob''s'!C2": "2023-11-15"}, writer.paid)
+
+	// the signature covers the cell, the payment and the expiration
+	assert.Equal(t, http.StatusForbidden, post(strings.Replace(target, "C2", "C4", 1)))
+	assert.Equal(t, http.StatusForbidden, post(strings.Replace(target, "rent", "phone", 1)))
+	assert.Equal(t, http.StatusForbidden, post(request("C2", "rent", "2023-11-01").URL("", "guess")))
+	// the row has to hold the same pending payment
+	assert.Equal(t, http.StatusConflict, post(request("C4", "rent", "2023-11-01").URL("", "secret")))
+	assert.Equal(t, http.StatusConflict, post(request("C4", "phone", "2023-12-20").URL("", "secret")))
+	assert.Equal(t, http.StatusConflict, post(request("C3", "water", "2023-11-10").URL("", "secret")))
+	assert.Len(t, writer.paid, 1)
+	// buttons expire
+	expired := request("C4", "phone", "2023-11-20")
+	expired.Expires = now
+	assert.Equal(t, http.StatusGone, post(expired.URL("", "secret")))
+	assert.Equal(t, http.StatusNoContent, post(request("C4", "phone", "2023-11-20").URL("", "secret")))
+	assert.Equal(t, "2023-11-15", writer.paid["'Bob''s'!C4"])
+
+	other := &PaidRequest{Cell: &PaidCell{SpreadsheetId: "def"}, Expires: expires}
+	assert.Equal(t, http.StatusNotFound, post(other.URL("", "secret")))
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(target, "https://example.com"), nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func Test_Run_PaidActions(t *testing.T) {
+	reader := &fakeSheetReader{sheets: map[string]map[string][][]interface{}{
+		"abc": {"household": {
+			{"Description", "Due Date", "Payment Date"},
+			{"rent", "2023-11-15", ""},
+			{"water, sewage", "2023-11-10", ""},
+			{"phone", "2023-11-20", ""},
+		}},
+	}}
+	config, err := ParseConfig([]byte(`
+ntfy_topic: topic
+ntfy_click_url: https://example.com/sheet
+ntfy_view_button: true
+callback_url: https://remindme.example.com
+callback_secret: secret
+sheets:
+  - spreadsheet_id: abc
+    name: household
+`))
+	require.NoError(t, err)
+	notifier := &stubNotifier{}
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: timeFromDate(t, "2023-11-15")}))
+	require.Equal(t, 1, len(notifier.notifications))
+
+	actions := strings.Split(notifier.notifications[0].Actions, "; ")
+	require.Equal(t, 3, len(actions))
+	assert.Equal(t, "view, View Sheet, https://example.com/sheet", actions[0])
+	water := &PaidRequest{Cell: &PaidCell{SpreadsheetId: "abc", Sheet: "household", Cell: "C3"}, Description: "water, sewage", Due: "2023-11-10", Expires: timeFromDate(t, "2023-11-15").Add(PaidButtonTTL)}
+	assert.Equal(t, "http, Paid water  sewage, "+water.URL(config.CallbackURL, "secret")+", method=POST, clear=true", actions[1])
+	assert.True(t, strings.HasPrefix(actions[2], "http, Paid rent, "))
+
+	_, err = ParseConfig([]byte("callback_url: https://remindme.example.com"))
+	assert.Error(t, err)
+}
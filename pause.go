@@ -0,0 +1,37 @@
+package remindme
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// PauseUntilEnv holds the date (YYYY-MM-DD) until which reports are paused
+const PauseUntilEnv = "PAUSE_UNTIL"
+
+const DefaultPauseFile = "remindme.pause"
+
+// PausedUntil returns the date until which reports are paused (inclusive,
+// in athens time) as set in the PAUSE_UNTIL env var or in the pause file;
+// ok is false when reports are not paused at now
+func PausedUntil(pauseFile string, now time.Time) (until time.Time, ok bool, err error) {
+	value := os.Getenv(PauseUntilEnv)
+	if value == "" && pauseFile != "" {
+		contents, err := os.ReadFile(pauseFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, false, fmt.Errorf("failed to read pause file: %v", err)
+		}
+		value = strings.TrimSpace(string(contents))
+	}
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	until, err = time.ParseInLocation(time.DateOnly, value, GreekTimeZone())
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid pause date %q: %v", value, err)
+	}
+	// the pause lasts for the whole of the given date
+	return until, now.In(GreekTimeZone()).Before(until.AddDate(0, 0, 1)), nil
+}
@@ -0,0 +1,45 @@
+package remindme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PausedUntil(t *testing.T) {
+	now := timeFromDate(t, "2023-11-06")
+
+	t.Setenv(PauseUntilEnv, "")
+	_, ok, err := PausedUntil(filepath.Join(t.TempDir(), "missing"), now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	pauseFile := filepath.Join(t.TempDir(), "remindme.pause")
+	require.NoError(t, os.WriteFile(pauseFile, []byte("2023-11-06\n"), 0644))
+	until, ok, err := PausedUntil(pauseFile, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2023, time.November, 6, 0, 0, 0, 0, GreekTimeZone()), until)
+
+	// the pause ends at the end of the date in athens time whatever the
+	// time zone of now
+	_, ok, err = PausedUntil(pauseFile, time.Date(2023, time.November, 6, 21, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, ok, err = PausedUntil(pauseFile, time.Date(2023, time.November, 6, 22, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	t.Setenv(PauseUntilEnv, "2023-11-05")
+	_, ok, err = PausedUntil(pauseFile, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	t.Setenv(PauseUntilEnv, "next week")
+	_, _, err = PausedUntil(pauseFile, now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package remindme
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// what happens to the reports of runs during quiet hours
+const (
+	QuietHoursDefer = "defer"
+	QuietHoursSkip  = "skip"
+)
+
+// HasQuietHours is true if quiet hours are configured
+func (c *Config) HasQuietHours() bool {
+	return c.QuietHoursStart != ""
+}
+
+func (c *Config) validateQuietHours() error {
+	if (c.QuietHoursStart == "") != (c.QuietHoursEnd == "") {
+		return fmt.Errorf("quiet_hours_start and quiet_hours_end need to be set together")
+	}
+	if c.QuietHoursMode != QuietHoursDefer && c.QuietHoursMode != QuietHoursSkip {
+		return fmt.Errorf("unknown quiet_hours_mode '%s' (expected %s or %s)", c.QuietHoursMode, QuietHoursDefer, QuietHoursSkip)
+	}
+	if !c.HasQuietHours() {
+		return nil
+	}
+	start, err := time.Parse("15:04", c.QuietHoursStart)
+	if err != nil {
+		return fmt.Errorf("invalid quiet_hours_start '%s' (expected HH:MM)", c.QuietHoursStart)
+	}
+	end, err := time.Parse("15:04", c.QuietHoursEnd)
+	if err != nil {
+		return fmt.Errorf("invalid quiet_hours_end '%s' (expected HH:MM)", c.QuietHoursEnd)
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("quiet_hours_start and quiet_hours_end can not be the same")
+	}
+	return nil
+}
+
+// QuietUntil returns the end of the quiet hours if now (in athens time) is
+// within them; the quiet hours may span midnight (e.g. 22:00 to 07:00)
+func (c *Config) QuietUntil(now time.Time) (time.Time, bool) {
+	if !c.HasQuietHours() {
+		return time.Time{}, false
+	}
+	// both have been validated
+	start, _ := time.Parse("15:04", c.QuietHoursStart)
+	end, _ := time.Parse("15:04", c.QuietHoursEnd)
+	now = now.In(GreekTimeZone())
+	at := func(t time.Time, days int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()+days, t.Hour(), t.Minute(), 0, 0, GreekTimeZone())
+	}
+	startToday, endToday := at(start, 0), at(end, 0)
+	if startToday.Before(endToday) {
+		if !now.Before(startToday) && now.Before(endToday) {
+			return endToday, true
+		}
+		return time.Time{}, false
+	}
+	if now.Before(endToday) {
+		return endToday, true
+	}
+	if !now.Before(startToday) {
+		return at(end, 1), true
+	}
+	return time.Time{}, false
+}
+
+// DeliverPending sends the deferred report of the state once its quiet
+// hours are over
+func DeliverPending(state StateStore, notifier Notifier, now time.Time) error {
+	store, err := NewReminderStore(state)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %v", err)
+	}
+	if store.Pending == nil || now.Before(store.Pending.Until) {
+		return nil
+	}
+	for len(store.Pending.Notifications) > 0 {
+		if err := notifier.Notify(store.Pending.Notifications[0]); err != nil {
+			// the rest are sent on the next attempt
+			if saveErr := store.Save(); saveErr != nil {
+				log.Printf("failed to save state: %v", saveErr)
+			}
+			return fmt.Errorf("failed to send deferred notification: %v", err)
+		}
+		store.Pending.Notifications = store.Pending.Notifications[1:]
+	}
+	log.Printf("sent the report deferred until %s", store.Pending.Until.Format(time.RFC3339))
+	store.Pending = nil
+	return store.Save()
+}
@@ -0,0 +1,158 @@
+package remindme
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_QuietUntil(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, time.November, day, hour, minute, 0, 0, GreekTimeZone())
+	}
+	kases := []struct {
+		start, end string
+		now        time.Time
+		quiet      bool
+		until      time.Time
+	}{
+		// a window within the day
+		{"13:00", "15:30", at(15, 12, 59), false, time.Time{}},
+		{"13:00", "15:30", at(15, 13, 0), true, at(15, 15, 30)},
+		{"13:00", "15:30", at(15, 15, 30), false, time.Time{}},
+		// a window spanning midnight
+		{"22:00", "07:00", at(15, 21, 59), false, time.Time{}},
+		{"22:00", "07:00", at(15, 22, 0), true, at(16, 7, 0)},
+		{"22:00", "07:00", at(16, 6, 59), true, at(16, 7, 0)},
+		{"22:00", "07:00", at(16, 7, 0), false, time.Time{}},
+		// athens time is used regardless of the time's location
+		{"22:00", "07:00", time.Date(2023, time.November, 15, 20, 30, 0, 0, time.UTC), true, at(16, 7, 0)},
+	}
+	for _, kase := range kases {
+		config := &Config{QuietHoursStart: kase.start, QuietHoursEnd: kase.end}
+		until, quiet := config.QuietUntil(kase.now)
+		assert.Equal(t, kase.quiet, quiet, kase)
+		assert.True(t, kase.until.Equal(until), kase)
+	}
+
+	until, quiet := (&Config{}).QuietUntil(at(15, 23, 0))
+	assert.False(t, quiet)
+	assert.True(t, until.IsZero())
+}
+
+func Test_ParseConfig_QuietHours(t *testing.T) {
+	config, err := ParseConfig([]byte(`quiet_hours_start: "22:00"` + "\n" + `quiet_hours_end: "07:00"`))
+	require.NoError(t, err)
+	assert.True(t, config.HasQuietHours())
+	assert.Equal(t, QuietHoursDefer, config.QuietHoursMode)
+
+	for _, contents := range []string{
+		`quiet_hours_start: "22:00"`,
+		`quiet_hours_end: "07:00"`,
+		`quiet_hours_start: "22"` + "\n" + `quiet_hours_end: "07:00"`,
+		`quiet_hours_start: "22:00"` + "\n" + `quiet_hours_end: "25:00"`,
+		`quiet_hours_start: "22:00"` + "\n" + `quiet_hours_end: "22:00"`,
+		`quiet_hours_start: "22:00"` + "\n" + `quiet_hours_end: "07:00"` + "\n" + `quiet_hours_mode: later`,
+	} {
+		_, err := ParseConfig([]byte(contents))
+		assert.Error(t, err, contents)
+	}
+}
+
+func Test_Run_QuietHours(t *testing.T) {
+	reader := &fakeSheetReader{sheets: map[string]map[string][][]interface{}{
+		"abc": {"household": {
+			{"Description", "Due Date", "Payment Date"},
+			{"water", "2023-11-12", ""},
+		}},
+	}}
+	// 23:30 in athens
+	now := time.Date(2023, time.November, 15, 21, 30, 0, 0, time.UTC)
+	morning := time.Date(2023, time.November, 16, 7, 0, 0, 0, GreekTimeZone())
+	newConfig := func(mode string) *Config {
+		config, err := ParseConfig([]byte(fmt.Sprintf(`
+ntfy_topic: topic
+state_file: %s
+quiet_hours_start: "22:00"
+quiet_hours_end: "07:00"
+quiet_hours_mode: %s
+sheets:
+  - spreadsheet_id: abc
+    name: household
+`, filepath.Join(t.TempDir(), "state.json"), mode)))
+		require.NoError(t, err)
+		return config
+	}
+
+	buf := &strings.Builder{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+	summary := "run summary: sheets=1 payments=1 delayed=1 today=0 upcoming=0 notified="
+
+	// skipped reports are not kept
+	config := newConfig(QuietHoursSkip)
+	notifier := &stubNotifier{}
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: now}))
+	assert.Empty(t, notifier.notifications)
+	assert.Contains(t, buf.String(), "not sending the report during quiet hours")
+	assert.Contains(t, buf.String(), summary+"false")
+	store, err := LoadReminderStore(config.StateFile)
+	require.NoError(t, err)
+	assert.Nil(t, store.Pending)
+
+	// deferred reports are sent once the quiet hours are over
+	config = newConfig(QuietHoursDefer)
+	buf.Reset()
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: now}))
+	assert.Empty(t, notifier.notifications)
+	assert.Contains(t, buf.String(), "deferring the report until the end of quiet hours")
+	assert.Contains(t, buf.String(), summary+"false")
+	store, err = LoadReminderStore(config.StateFile)
+	require.NoError(t, err)
+	require.NotNil(t, store.Pending)
+	assert.True(t, morning.Equal(store.Pending.Until))
+	require.Len(t, store.Pending.Notifications, 1)
+	assert.Contains(t, store.Pending.Notifications[0].Message, "water")
+
+	require.NoError(t, DeliverPending(NewFileStateStore(config.StateFile), notifier, morning.Add(-time.Minute)))
+	assert.Empty(t, notifier.notifications)
+	require.NoError(t, DeliverPending(NewFileStateStore(config.StateFile), notifier, morning))
+	require.Len(t, notifier.notifications, 1)
+	assert.Contains(t, notifier.notifications[0].Message, "water")
+	store, err = LoadReminderStore(config.StateFile)
+	require.NoError(t, err)
+	assert.Nil(t, store.Pending)
+	require.NoError(t, DeliverPending(NewFileStateStore(config.StateFile), notifier, morning))
+	assert.Len(t, notifier.notifications, 1)
+
+	// a report sent after the quiet hours replaces the deferred one
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: now}))
+	require.NoError(t, Run(config, &Readers{Google: reader}, notifier, &RunOptions{Now: morning}))
+	assert.Len(t, notifier.notifications, 2)
+	store, err = LoadReminderStore(config.StateFile)
+	require.NoError(t, err)
+	assert.Nil(t, store.Pending)
+
+	// deferred reports are neither counted as reminders nor recorded as
+	// reported (until they are sent)
+	config = newConfig(QuietHoursDefer)
+	config.MaxReminders = 1
+	config.NotifyOncePerDay = true
+	require.NoError(t, Run(config, &Readers{Google: reader}, &stubNotifier{}, &RunOptions{Now: now}))
+	store, err = LoadReminderStore(config.StateFile)
+	require.NoError(t, err)
+	require.NotNil(t, store.Pending)
+	assert.Empty(t, store.Counts)
+	assert.Empty(t, store.Notified)
+	deferred := &stubNotifier{}
+	require.NoError(t, Run(config, &Readers{Google: reader}, deferred, &RunOptions{Now: morning}))
+	require.Len(t, deferred.notifications, 1)
+	assert.Contains(t, deferred.notifications[0].Message, "water")
+}
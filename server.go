@@ -0,0 +1,102 @@
+package remindme
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server exposes the http endpoints of the application in cron mode
+type Server struct {
+	nextRun func() time.Time
+	// marks payments as paid (if enabled)
+	paid http.Handler
+	// receives the change notifications of the spreadsheets (if watched)
+	changes http.Handler
+	// triggers a run on demand (if enabled)
+	run http.Handler
+}
+
+func NewServer(nextRun func() time.Time) *Server {
+	return &Server{nextRun: nextRun}
+}
+
+// WithPaidHandler enables the callback endpoint of the "paid" actions
+func (s *Server) WithPaidHandler(paid http.Handler) *Server {
+	s.paid = paid
+	return s
+}
+
+// WithChangeHandler enables the endpoint of the change notifications
+func (s *Server) WithChangeHandler(changes http.Handler) *Server {
+	s.changes = changes
+	return s
+}
+
+// WithRunHandler enables the endpoint that triggers a run on demand
+func (s *Server) WithRunHandler(run http.Handler) *Server {
+	s.run = run
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.health)
+	if s.paid != nil {
+		mux.Handle("/paid", s.paid)
+	}
+	if s.changes != nil {
+		mux.Handle("/changes", s.changes)
+	}
+	if s.run != nil {
+		mux.Handle("/run", s.run)
+	}
+	return mux
+}
+
+type healthResponse struct {
+	Status  string    `json:"status"`
+	NextRun time.Time `json:"next_run"`
+}
+
+// health reports that the application is up along with the next scheduled run
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&healthResponse{Status: "ok", NextRun: s.nextRun()})
+}
+
+// RunHandler runs the report on demand and responds with its text; the
+// request needs the shared secret as a bearer token
+type RunHandler struct {
+	secret string
+	run    func() (string, error)
+}
+
+func NewRunHandler(secret string, run func() (string, error)) *RunHandler {
+	return &RunHandler{secret: secret, run: run}
+}
+
+func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	report, err := h.run()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(report + "\n"))
+}
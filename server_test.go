@@ -0,0 +1,76 @@
+package remindme
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Server_Health(t *testing.T) {
+	next := time.Date(2023, time.November, 24, 9, 5, 0, 0, GreekTimeZone())
+	server := NewServer(func() time.Time { return next })
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	res := healthResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, "ok", res.Status)
+	assert.True(t, next.Equal(res.NextRun))
+}
+
+func Test_RunHandler(t *testing.T) {
+	runs := 0
+	var err error
+	handler := NewRunHandler("secret", func() (string, error) {
+		runs++
+		return "💸 Today: rent", err
+	})
+	kases := []struct {
+		method        string
+		authorization string
+		status        int
+		runs          int
+	}{
+		{http.MethodGet, "Bearer secret", http.StatusMethodNotAllowed, 0},
+		{http.MethodPost, "", http.StatusForbidden, 0},
+		{http.MethodPost, "Bearer other", http.StatusForbidden, 0},
+		{http.MethodPost, "secret", http.StatusForbidden, 0},
+		{http.MethodPost, "Bearer secret", http.StatusOK, 1},
+	}
+	for _, kase := range kases {
+		req := httptest.NewRequest(kase.method, "/run", nil)
+		req.Header.Set("Authorization", kase.authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, kase.status, rec.Code, kase)
+		assert.Equal(t, kase.runs, runs, kase)
+	}
+
+	// the report is returned through the server
+	server := NewServer(time.Now).WithRunHandler(handler)
+	req := httptest.NewRequest(http.MethodPost, "/run", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "💸 Today: rent\n", rec.Body.String())
+
+	err = errors.New("failed to read sheets")
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "failed to read sheets")
+
+	// the endpoint is only there when enabled
+	rec = httptest.NewRecorder()
+	NewServer(time.Now).Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,380 @@
+package remindme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateStore persists the state of the features that need it (e.g.
+// reminder counts, snapshots and deferred reports) as json blobs by key
+type StateStore interface {
+	// Get returns the blob of key (nil if there is none)
+	Get(key string) (json.RawMessage, error)
+	// Set replaces the blob of key (a nil blob removes it)
+	Set(key string, blob json.RawMessage) error
+}
+
+// BatchStateStore is a StateStore that can also replace several blobs at
+// once (so that they are saved together or not at all)
+type BatchStateStore interface {
+	StateStore
+	// SetAll replaces the blobs of the keys (nil blobs remove them)
+	SetAll(blobs map[string]json.RawMessage) error
+}
+
+// FileStateStore keeps the blobs in a json file (as a single object); a
+// missing file is an empty store
+type FileStateStore struct {
+	path string
+}
+
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+func (s *FileStateStore) read() (map[string]json.RawMessage, error) {
+	blobs := map[string]json.RawMessage{}
+	contents, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return blobs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &blobs); err != nil {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+func (s *FileStateStore) Get(key string) (json.RawMessage, error) {
+	blobs, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return blobs[key], nil
+}
+
+func (s *FileStateStore) Set(key string, blob json.RawMessage) error {
+	return s.SetAll(map[string]json.RawMessage{key: blob})
+}
+
+// SetAll updates the blobs of the file in a single write; the file is
+// replaced atomically (by renaming a temporary file) so that it is never
+// left half-written
+func (s *FileStateStore) SetAll(updates map[string]json.RawMessage) error {
+	blobs, err := s.read()
+	if err != nil {
+		return err
+	}
+	for key, blob := range updates {
+		if blob == nil {
+			delete(blobs, key)
+		} else {
+			blobs[key] = blob
+		}
+	}
+	contents, err := json.MarshalIndent(blobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// ReminderStore persists how many times each payment has been reported,
+// the payments reported today, the payments that were pending at the
+// last run and the report deferred until the end of the quiet hours (if
+// any)
+type ReminderStore struct {
+	state    StateStore
+	Counts   map[string]*ReminderCount
+	Notified map[string]*Notified
+	Snapshot *Snapshot
+	Pending  *PendingReport
+}
+
+// the keys of the reminder store's blobs
+const (
+	stateKeyCounts   = "counts"
+	stateKeyNotified = "notified"
+	stateKeySnapshot = "snapshot"
+	stateKeyPending  = "pending"
+)
+
+// ReminderCount is the number of reminders sent for a payment's due date
+type ReminderCount struct {
+	Due   string `json:"due"`
+	Count int    `json:"count"`
+}
+
+// Notified is the day a payment was last reported on along with how
+// urgent it was at the time
+type Notified struct {
+	Date    string `json:"date"`
+	Urgency int    `json:"urgency"`
+}
+
+// Snapshot holds the description of each pending payment (by its
+// paymentKey) at the time of a run
+type Snapshot struct {
+	Taken    time.Time         `json:"taken"`
+	Payments map[string]string `json:"pending"`
+}
+
+// PendingReport holds the notifications of a report that is deferred until
+// the end of the quiet hours
+type PendingReport struct {
+	Until         time.Time       `json:"until"`
+	Notifications []*Notification `json:"notifications"`
+}
+
+// LoadReminderStore reads the store from the file at path (a missing file
+// is an empty store)
+func LoadReminderStore(path string) (*ReminderStore, error) {
+	return NewReminderStore(NewFileStateStore(path))
+}
+
+// NewReminderStore reads the store from the state store
+func NewReminderStore(state StateStore) (*ReminderStore, error) {
+	store := &ReminderStore{state: state}
+	values := map[string]interface{}{
+		stateKeyCounts:   &store.Counts,
+		stateKeyNotified: &store.Notified,
+		stateKeySnapshot: &store.Snapshot,
+		stateKeyPending:  &store.Pending,
+	}
+	for key, value := range values {
+		blob, err := state.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if blob == nil {
+			continue
+		}
+		if err := json.Unmarshal(blob, value); err != nil {
+			return nil, fmt.Errorf("invalid state %s: %v", key, err)
+		}
+	}
+	if store.Counts == nil {
+		store.Counts = map[string]*ReminderCount{}
+	}
+	return store, nil
+}
+
+func (s *ReminderStore) Save() error {
+	values := map[string]interface{}{stateKeyCounts: s.Counts}
+	// unset values are removed
+	values[stateKeyNotified], values[stateKeySnapshot], values[stateKeyPending] = nil, nil, nil
+	if len(s.Notified) > 0 {
+		values[stateKeyNotified] = s.Notified
+	}
+	if s.Snapshot != nil {
+		values[stateKeySnapshot] = s.Snapshot
+	}
+	if s.Pending != nil {
+		values[stateKeyPending] = s.Pending
+	}
+	blobs := map[string]json.RawMessage{}
+	for key, value := range values {
+		var blob json.RawMessage
+		if value != nil {
+			var err error
+			if blob, err = json.Marshal(value); err != nil {
+				return err
+			}
+		}
+		blobs[key] = blob
+	}
+	if batch, ok := s.state.(BatchStateStore); ok {
+		return batch.SetAll(blobs)
+	}
+	for key, blob := range blobs {
+		if err := s.state.Set(key, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paymentKey identifies a payment in the state by its sheet, original
+// description and due date (so that recurring payments and payments of
+// the same description in other sheets are kept apart and a new due date
+// starts afresh)
+func paymentKey(p *Payment) string {
+	return fmt.Sprintf("%s/%s@%s", p.sheet, p.original, p.dueDate())
+}
+
+// Mute marks the payments that have already been reminded of maxReminders
+// times as muted (so they are left out of the sections but still count
+// towards the totals) and counts a reminder for the remaining payments
+// that are due (today or delayed); payments that are muted already (e.g.
+// reported earlier today) are not reminded of and so not counted
+func (s *ReminderStore) Mute(payments []*Payment, maxReminders int, now time.Time) {
+	for _, p := range payments {
+		if !p.IsDue() || p.muted {
+			continue
+		}
+		key := paymentKey(p)
+		count, ok := s.Counts[key]
+		if !ok {
+			count = &ReminderCount{Due: p.due.Format(time.DateOnly)}
+			s.Counts[key] = count
+		}
+		if count.Count >= maxReminders {
+			p.muted = true
+			continue
+		}
+		if p.DiffFromNowInDays(now) <= 0 {
+			count.Count += 1
+		}
+	}
+}
+
+// Forget drops the state of the payments that are no longer pending (e.g.
+// paid or rescheduled) given all the pending payments
+func (s *ReminderStore) Forget(payments []*Payment) {
+	pending := map[string]bool{}
+	for _, p := range payments {
+		pending[paymentKey(p)] = true
+	}
+	for key := range s.Counts {
+		if !pending[key] {
+			delete(s.Counts, key)
+		}
+	}
+}
+
+// Dedupe mutes the payments that have already been reported today (so
+// they are left out of the sections but still count towards the totals)
+// unless they have become more urgent since (e.g. from coming up to due
+// today) and records the remaining ones as reported; payments are
+// identified by their paymentKey (so a new due date is reported anew) and
+// the payments that are not given (e.g. of other tags) keep their records
+// of today -- it returns the number of muted payments
+func (s *ReminderStore) Dedupe(payments []*Payment, now time.Time) int {
+	today := now.In(GreekTimeZone()).Format(time.DateOnly)
+	// only today's records are needed
+	for key, last := range s.Notified {
+		if last.Date != today {
+			delete(s.Notified, key)
+		}
+	}
+	if s.Notified == nil {
+		s.Notified = map[string]*Notified{}
+	}
+	repeated := 0
+	for _, p := range payments {
+		key := paymentKey(p)
+		urgency := PaymentUrgency(p, now)
+		if last, ok := s.Notified[key]; ok && urgency <= last.Urgency {
+			p.muted = true
+			repeated += 1
+			continue
+		}
+		s.Notified[key] = &Notified{Date: today, Urgency: urgency}
+	}
+	return repeated
+}
+
+// PaymentUrgency ranks how urgent a payment is: delayed (3), due today (2),
+// due later (1) or not scheduled (0)
+func PaymentUrgency(p *Payment, now time.Time) int {
+	if !p.IsDue() {
+		return 0
+	}
+	days := p.DiffFromNowInDays(now)
+	if days < 0 {
+		return 3
+	}
+	if days == 0 {
+		return 2
+	}
+	return 1
+}
+
+// Changes compares the pending payments to the last snapshot and returns
+// the payments that became delayed since, the ones that are no longer
+// pending (i.e. paid) and the ones that were added; nothing has changed
+// if there is no snapshot yet
+func (s *ReminderStore) Changes(payments []*Payment, now time.Time) (delayed, paid, added []string) {
+	// snapshots of older versions (keyed by description) are ignored
+	if s.Snapshot == nil || s.Snapshot.Payments == nil {
+		return nil, nil, nil
+	}
+	pending := map[string]bool{}
+	for _, p := range payments {
+		pending[paymentKey(p)] = true
+	}
+	// the payments that are no longer pending by their sheet and original
+	// description (to tell the rescheduled payments from the paid ones)
+	missing := map[string][]string{}
+	for key := range s.Snapshot.Payments {
+		if !pending[key] {
+			id := unscheduledKey(key)
+			missing[id] = append(missing[id], key)
+		}
+	}
+	for _, p := range payments {
+		key := paymentKey(p)
+		if _, ok := s.Snapshot.Payments[key]; !ok {
+			id := unscheduledKey(key)
+			if len(missing[id]) == 0 {
+				added = append(added, p.description)
+				continue
+			}
+			// rescheduled -- the payment of the old due date is not paid
+			missing[id] = missing[id][1:]
+		} else if p.DiffFromNowInDays(s.Snapshot.Taken) <= -1 {
+			// already delayed at the time of the snapshot
+			continue
+		}
+		if p.IsDue() && p.DiffFromNowInDays(now) <= -1 {
+			delayed = append(delayed, p.description)
+		}
+	}
+	for _, keys := range missing {
+		for _, key := range keys {
+			paid = append(paid, s.Snapshot.Payments[key])
+		}
+	}
+	sort.Strings(paid)
+	return delayed, paid, added
+}
+
+// unscheduledKey is the paymentKey without the due date
+func unscheduledKey(key string) string {
+	return key[:strings.LastIndex(key, "@")]
+}
+
+// TakeSnapshot records the pending payments for comparing with the next run
+func (s *ReminderStore) TakeSnapshot(payments []*Payment, now time.Time) {
+	snapshot := &Snapshot{Taken: now, Payments: map[string]string{}}
+	for _, p := range payments {
+		snapshot.Payments[paymentKey(p)] = p.description
+	}
+	s.Snapshot = snapshot
+}
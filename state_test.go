@@ -0,0 +1,288 @@
+package remindme
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReminderStore_Mute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	today := timeFromDate(t, "2023-11-05")
+	newPayments := func() []*Payment {
+		payments := []*Payment{
+			NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04")),
+			NewPayment("bar").WithDueDate(timeFromDate(t, "2023-11-10")),
+			NewPayment("baz"),
+			// same description in another sheet
+			NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04")),
+		}
+		payments[3].sheet = "other"
+		return payments
+	}
+	muted := func(payments []*Payment) []bool {
+		found := []bool{}
+		for _, p := range payments {
+			found = append(found, p.muted)
+		}
+		return found
+	}
+
+	for run := 1; run <= 3; run++ {
+		store, err := LoadReminderStore(path)
+		require.NoError(t, err)
+		payments := newPayments()
+		store.Mute(payments, 2, today)
+		require.NoError(t, store.Save())
+		if run <= 2 {
+			assert.Equal(t, []bool{false, false, false, false}, muted(payments), run)
+		} else {
+			// both foo payments have been reported twice already
+			assert.Equal(t, []bool{true, false, false, true}, muted(payments), run)
+		}
+	}
+
+	// a new due date (e.g. of the next month's payment) starts afresh and
+	// the counts of payments that are no longer pending are forgotten
+	store, err := LoadReminderStore(path)
+	require.NoError(t, err)
+	payments := newPayments()
+	payments[0].WithDueDate(timeFromDate(t, "2023-11-05"))
+	store.Forget(payments)
+	store.Mute(payments, 2, today)
+	assert.Equal(t, []bool{false, false, false, true}, muted(payments))
+	assert.Equal(t, 1, store.Counts["/foo@2023-11-05"].Count)
+	assert.Equal(t, 0, store.Counts["/bar@2023-11-10"].Count)
+	assert.Equal(t, 2, store.Counts["other/foo@2023-11-04"].Count)
+	assert.NotContains(t, store.Counts, "/foo@2023-11-04")
+
+	// muted payments are left out of the sections but not of the total
+	config := &Config{SectionOrder: []string{SectionDelayed, SectionTotal}, TotalWindowDays: 30}
+	sections := BuildSections(config, payments[3:], today)
+	require.Len(t, sections, 1)
+	assert.Equal(t, SectionTotal, sections[0].Key)
+	assert.Contains(t, sections[0].Text, "1 payment")
+}
+
+func Test_ReminderStore_Changes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	yesterday := timeFromDate(t, "2023-11-05")
+	today := timeFromDate(t, "2023-11-06")
+
+	store, err := LoadReminderStore(path)
+	require.NoError(t, err)
+	payments := []*Payment{
+		NewPayment("foo").WithDueDate(yesterday),
+		NewPayment("bar").WithDueDate(timeFromDate(t, "2023-11-01")),
+		NewPayment("baz"),
+	}
+	delayed, paid, added := store.Changes(payments, yesterday)
+	assert.Empty(t, delayed)
+	assert.Empty(t, paid)
+	assert.Empty(t, added)
+	store.TakeSnapshot(payments, yesterday)
+	require.NoError(t, store.Save())
+
+	store, err = LoadReminderStore(path)
+	require.NoError(t, err)
+	payments = []*Payment{
+		NewPayment("foo").WithDueDate(yesterday),
+		NewPayment("bar").WithDueDate(timeFromDate(t, "2023-11-01")),
+		NewPayment("qux").WithDueDate(today),
+	}
+	delayed, paid, added = store.Changes(payments, today)
+	// bar was already delayed at the time of the snapshot
+	assert.Equal(t, []string{"foo"}, delayed)
+	assert.Equal(t, []string{"baz"}, paid)
+	assert.Equal(t, []string{"qux"}, added)
+	assert.Equal(t, "🔔 Changes:\n  Delayed: foo\n  Paid: baz\n  New: qux", SummarizeChanges(delayed, paid, added))
+
+	// payments are identified by their sheet, description and due date
+	// (rescheduled ones are neither paid nor new)
+	payments = []*Payment{
+		NewPayment("rent").WithDueDate(timeFromDate(t, "2023-11-01")),
+		NewPayment("rent").WithDueDate(timeFromDate(t, "2023-12-01")),
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-10")),
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-10")),
+	}
+	payments[3].sheet = "other"
+	store.TakeSnapshot(payments, yesterday)
+	payments = []*Payment{
+		NewPayment("rent").WithDueDate(timeFromDate(t, "2023-12-01")),
+		NewPayment("rent").WithDueDate(timeFromDate(t, "2023-12-01")),
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-02")),
+	}
+	payments[1].sheet = "other"
+	delayed, paid, added = store.Changes(payments, today)
+	assert.Equal(t, []string{"water"}, delayed)
+	assert.Equal(t, []string{"rent", "water"}, paid)
+	assert.Equal(t, []string{"rent"}, added)
+
+	// snapshots of older versions are ignored
+	store.Snapshot = &Snapshot{Taken: yesterday}
+	delayed, paid, added = store.Changes(payments, today)
+	assert.Empty(t, delayed)
+	assert.Empty(t, paid)
+	assert.Empty(t, added)
+}
+
+type memoryStateStore map[string]json.RawMessage
+
+func (s memoryStateStore) Get(key string) (json.RawMessage, error) {
+	return s[key], nil
+}
+
+func (s memoryStateStore) Set(key string, blob json.RawMessage) error {
+	if blob == nil {
+		delete(s, key)
+	} else {
+		s[key] = blob
+	}
+	return nil
+}
+
+func Test_FileStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := NewFileStateStore(path)
+	blob, err := state.Get("counts")
+	require.NoError(t, err)
+	assert.Nil(t, blob)
+
+	require.NoError(t, state.Set("counts", json.RawMessage(`{"foo":{"due":"2023-11-04","count":2}}`)))
+	require.NoError(t, state.Set("other", json.RawMessage(`[1,2]`)))
+	blob, err = NewFileStateStore(path).Get("other")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[1,2]`, string(blob))
+	require.NoError(t, state.Set("other", nil))
+	blob, err = state.Get("other")
+	require.NoError(t, err)
+	assert.Nil(t, blob)
+
+	// several blobs are replaced in a single write (leaving no temporary
+	// files behind)
+	require.NoError(t, state.SetAll(map[string]json.RawMessage{"a": json.RawMessage(`1`), "b": json.RawMessage(`2`), "counts": nil}))
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":1,"b":2}`, string(contents))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	require.NoError(t, state.Set("counts", json.RawMessage(`{"foo":{"due":"2023-11-04","count":2}}`)))
+
+	// the reminder store keeps its values under their own keys
+	store, err := LoadReminderStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.Counts["foo"].Count)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = LoadReminderStore(path)
+	assert.Error(t, err)
+}
+
+func Test_ReminderStore_StateStore(t *testing.T) {
+	state := memoryStateStore{}
+	store, err := NewReminderStore(state)
+	require.NoError(t, err)
+	today := timeFromDate(t, "2023-11-05")
+	payments := []*Payment{NewPayment("foo").WithDueDate(today)}
+	store.Mute(payments, 2, today)
+	store.TakeSnapshot(payments, today)
+	require.NoError(t, store.Save())
+	assert.Contains(t, state, "counts")
+	assert.Contains(t, state, "snapshot")
+	assert.NotContains(t, state, "pending")
+
+	store, err = NewReminderStore(state)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Counts["/foo@2023-11-05"].Count)
+	require.NotNil(t, store.Snapshot)
+
+	// runs use the given state store
+	reader := &fakeSheetReader{sheets: map[string]map[string][][]interface{}{
+		"abc": {"household": {{"Description", "Due Date", "Payment Date"}, {"water", "2023-11-04", ""}}},
+	}}
+	config, err := ParseConfig([]byte("ntfy_topic: topic\nmax_reminders: 1\nsheets:\n  - spreadsheet_id: abc\n    name: household"))
+	require.NoError(t, err)
+	state = memoryStateStore{}
+	require.NoError(t, Run(config, &Readers{Google: reader}, &stubNotifier{}, &RunOptions{Now: today, State: state}))
+	store, err = NewReminderStore(state)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Counts["household/water@2023-11-04"].Count)
+}
+
+func Test_ReminderStore_Dedupe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	morning := time.Date(2023, time.November, 5, 9, 0, 0, 0, GreekTimeZone())
+	evening := time.Date(2023, time.November, 5, 18, 0, 0, 0, GreekTimeZone())
+	// the descriptions of the payments left to report
+	reported := func(payments []*Payment) []string {
+		found := []string{}
+		for _, p := range unmutedPayments(payments) {
+			found = append(found, p.description)
+		}
+		return found
+	}
+	fresh := func() []*Payment {
+		return []*Payment{
+			NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04")),
+			NewPayment("bar").WithDueDate(timeFromDate(t, "2023-11-05")),
+			NewPayment("baz"),
+			NewPayment("qux").WithDueDate(timeFromDate(t, "2023-11-10")),
+		}
+	}
+
+	store, err := LoadReminderStore(path)
+	require.NoError(t, err)
+	payments := []*Payment{
+		NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04")),
+		NewPayment("bar").WithDueDate(timeFromDate(t, "2023-11-07")),
+		NewPayment("baz"),
+	}
+	assert.Equal(t, 0, store.Dedupe(payments, morning))
+	assert.Equal(t, []string{"foo", "bar", "baz"}, reported(payments))
+	require.NoError(t, store.Save())
+
+	// only new, rescheduled or escalated payments are reported again today
+	// and the rest are muted (but kept)
+	store, err = LoadReminderStore(path)
+	require.NoError(t, err)
+	payments = fresh()
+	assert.Equal(t, 2, store.Dedupe(payments, evening))
+	assert.Equal(t, []string{"bar", "qux"}, reported(payments))
+	assert.Len(t, payments, 4)
+	require.NoError(t, store.Save())
+
+	// the records of the payments left out of a run (e.g. by -only-tag) are
+	// kept and payments of other sheets are told apart
+	store, err = LoadReminderStore(path)
+	require.NoError(t, err)
+	other := NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04"))
+	other.sheet = "other"
+	assert.Equal(t, 0, store.Dedupe([]*Payment{other}, evening))
+	payments = fresh()
+	assert.Equal(t, 4, store.Dedupe(payments, evening))
+	assert.Empty(t, reported(payments))
+	assert.Len(t, store.Notified, 6)
+	require.NoError(t, store.Save())
+
+	// everything is reported again the next day
+	store, err = LoadReminderStore(path)
+	require.NoError(t, err)
+	payments = fresh()
+	assert.Equal(t, 0, store.Dedupe(payments, morning.AddDate(0, 0, 1)))
+	assert.Len(t, reported(payments), 4)
+	assert.Len(t, store.Notified, 4)
+}
+
+func Test_PaymentUrgency(t *testing.T) {
+	today := timeFromDate(t, "2023-11-05")
+	assert.Equal(t, 3, PaymentUrgency(NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-04")), today))
+	assert.Equal(t, 2, PaymentUrgency(NewPayment("foo").WithDueDate(today), today))
+	assert.Equal(t, 1, PaymentUrgency(NewPayment("foo").WithDueDate(timeFromDate(t, "2023-11-06")), today))
+	assert.Equal(t, 0, PaymentUrgency(NewPayment("foo"), today))
+}
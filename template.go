@@ -0,0 +1,152 @@
+package remindme
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultReportTemplate renders the report in the default format (i.e. the
+// non-empty sections one per line)
+const DefaultReportTemplate = `{{range $i, $s := .Sections}}{{if $i}}
+{{end}}{{$s.Text}}{{else}}` + NothingToReport + `{{end}}`
+
+// ReportData is the data that report templates are rendered with
+type ReportData struct {
+	Now time.Time
+	// the non-empty sections of the default format (in section_order)
+	Sections []*ReportSection
+	// the payments of each section (in sort_by order)
+	Priority  []*TemplatePayment
+	Delayed   []*TemplatePayment
+	DueSoon   []*TemplatePayment
+	Today     []*TemplatePayment
+	ComingUp  []*TemplatePayment
+	ThisMonth []*TemplatePayment
+	Undated   []*TemplatePayment
+	Optional  []*TemplatePayment
+	// the (non optional) payments due within the next TotalWindowDays
+	Total           []*TemplatePayment
+	TotalWindowDays int
+}
+
+// TemplatePayment is a payment as seen by report templates
+type TemplatePayment struct {
+	Description string
+	// the due date in display_date_format (empty if there is none) and the
+	// days until then (negative when delayed)
+	Due  string
+	Days int
+	// the amount along with its currency (empty if there is none)
+	Amount   string
+	Category string
+	Tags     []string
+}
+
+var templateFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"pluralize": pluralize,
+	// descriptions joins the descriptions of the payments using ", "
+	"descriptions": func(payments []*TemplatePayment) string {
+		descriptions := []string{}
+		for _, p := range payments {
+			descriptions = append(descriptions, p.Description)
+		}
+		return strings.Join(descriptions, ", ")
+	},
+}
+
+// ParseReportTemplate parses a report template (with the template functions)
+func ParseReportTemplate(text string) (*template.Template, error) {
+	return template.New("report").Funcs(templateFuncs).Parse(text)
+}
+
+// loadReportTemplate parses the inline report_template or the contents of
+// report_template_file (if any)
+func (c *Config) loadReportTemplate() error {
+	text := c.ReportTemplate
+	if c.ReportTemplateFile != "" {
+		contents, err := os.ReadFile(c.ReportTemplateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read report_template_file: %v", err)
+		}
+		text = string(contents)
+	}
+	if text == "" {
+		return nil
+	}
+	tmpl, err := ParseReportTemplate(text)
+	if err != nil {
+		return fmt.Errorf("invalid report template: %v", err)
+	}
+	c.reportTemplate = tmpl
+	return nil
+}
+
+// NewReportData buckets the payments as in the sections of the report
+func NewReportData(config *Config, payments []*Payment, now time.Time) *ReportData {
+	required, optional := PartitionOptionalPayments(payments)
+	reportable := reportablePayments(config, payments)
+	priority, _ := PartitionPriorityPayments(unmutedPayments(required))
+	optional = unmutedPayments(optional)
+	_, windowed := PartitionPriorityPayments(reportable)
+
+	total := []*Payment{}
+	for _, p := range required {
+		if p.IsDue() && p.DiffFromNowInDays(now) <= config.TotalWindowDays {
+			total = append(total, p)
+		}
+	}
+
+	today := FindPaymentsAt(windowed, 0, now)
+	dueSoon := []*Payment{}
+	if config.HasSection(SectionDueSoon) {
+		dueSoon = PaymentsDueSoon(today, config.DueSoonHours, now)
+		today = FindPaymentsAfterHours(today, config.DueSoonHours, now)
+	}
+
+	view := func(payments []*Payment) []*TemplatePayment {
+		return templatePayments(config.SortPayments(payments), now, config.DisplayDateFormat)
+	}
+	return &ReportData{
+		Now:             now,
+		Sections:        BuildSections(config, payments, now),
+		Priority:        view(priority),
+		Delayed:         view(FindPaymentsUntil(windowed, -1, now)),
+		DueSoon:         view(dueSoon),
+		Today:           view(today),
+		ComingUp:        view(PaymentsComingUp(windowed, now, config)),
+		ThisMonth:       view(PaymentsThisMonth(windowed, now, config)),
+		Undated:         view(FindUndatedPayments(windowed)),
+		Optional:        view(optional),
+		Total:           view(total),
+		TotalWindowDays: config.TotalWindowDays,
+	}
+}
+
+func templatePayments(payments []*Payment, now time.Time, dateFormat string) []*TemplatePayment {
+	views := []*TemplatePayment{}
+	for _, p := range payments {
+		view := &TemplatePayment{Description: p.Label(), Category: p.category, Tags: p.tags}
+		if p.IsDue() {
+			view.Due = p.due.Format(dateFormat)
+			view.Days = p.DiffFromNowInDays(now)
+		}
+		if p.hasAmount {
+			view.Amount = formatMoney(p.amount, p.currency)
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// RenderReport renders the report data using the template
+func RenderReport(tmpl *template.Template, data *ReportData) (string, error) {
+	report := &strings.Builder{}
+	if err := tmpl.Execute(report, data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(report.String(), "\n"), nil
+}
@@ -0,0 +1,69 @@
+package remindme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DefaultReportTemplate(t *testing.T) {
+	now := timeFromDate(t, "2023-11-15")
+	payments := []*Payment{
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-12")),
+		NewPayment("rent").WithDueDate(now).WithAmount(800).WithCurrency("€"),
+		NewPayment("phone").WithDueDate(timeFromDate(t, "2023-11-16")),
+		NewPayment("gym").AsOptional(),
+	}
+	config, err := ParseConfig([]byte(""))
+	require.NoError(t, err)
+	tmpl, err := ParseReportTemplate(DefaultReportTemplate)
+	require.NoError(t, err)
+
+	for _, p := range [][]*Payment{payments, {}} {
+		report, err := RenderReport(tmpl, NewReportData(config, p, now))
+		require.NoError(t, err)
+		assert.Equal(t, BuildReport(config, p, now), report)
+	}
+}
+
+func Test_BuildReport_Template(t *testing.T) {
+	now := timeFromDate(t, "2023-11-15")
+	payments := []*Payment{
+		NewPayment("water").WithDueDate(timeFromDate(t, "2023-11-12")),
+		NewPayment("power").WithDueDate(timeFromDate(t, "2023-11-10")).WithAmount(40.5).WithCurrency("€"),
+		NewPayment("rent").WithDueDate(now),
+		NewPayment("phone").WithDueDate(timeFromDate(t, "2023-11-16")),
+	}
+	config, err := ParseConfig([]byte(`
+report_template: |
+  Late: {{descriptions .Delayed}}
+  {{range .Delayed}}{{.Description}} {{.Due}} ({{.Days}}){{if .Amount}} {{.Amount}}{{end}}
+  {{end}}Today: {{len .Today}}, next: {{descriptions .ComingUp}}
+  {{pluralize (len .Total) "payment"}} in {{.TotalWindowDays}} days
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "Late: power, water\npower 2023-11-10 (-5) €40.50\nwater 2023-11-12 (-3)\nToday: 1, next: phone\n4 payments in 30 days", BuildReport(config, payments, now))
+
+	// failing templates fall back to the default format
+	config, err = ParseConfig([]byte(`report_template: "{{.Missing}}"`))
+	require.NoError(t, err)
+	assert.Contains(t, BuildReport(config, payments, now), "⚠ Delayed: power, water")
+}
+
+func Test_ParseConfig_ReportTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte("{{len .Today}} due today"), 0644))
+	config, err := ParseConfig([]byte("report_template_file: " + path))
+	require.NoError(t, err)
+	assert.Equal(t, "1 due today", BuildReport(config, []*Payment{NewPayment("rent").WithDueDate(timeFromDate(t, "2023-11-15"))}, timeFromDate(t, "2023-11-15")))
+
+	_, err = ParseConfig([]byte(`report_template: "{{.Today"`))
+	assert.ErrorContains(t, err, "invalid report template")
+	_, err = ParseConfig([]byte("report_template_file: " + filepath.Join(t.TempDir(), "missing.tmpl")))
+	assert.Error(t, err)
+	_, err = ParseConfig([]byte("report_template: foo\nreport_template_file: " + path))
+	assert.Error(t, err)
+}
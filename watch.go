@@ -0,0 +1,338 @@
+package remindme
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	// how long a watch channel is requested for (drive may shorten it)
+	WatchChannelTTL = 24 * time.Hour
+	// channels are renewed this long before they expire
+	WatchRenewMargin = 10 * time.Minute
+	// a run is triggered once no changes have arrived for this long (edits
+	// of a sheet arrive as a burst of notifications)
+	WatchDebounce = time.Minute
+	// the changes of a spreadsheet are ignored for this long after the
+	// instance writes to it (e.g. to mark a payment as paid)
+	OwnWriteWindow = 2 * time.Minute
+)
+
+// WatchChannel is a push notification channel for the changes of a
+// spreadsheet
+type WatchChannel struct {
+	Id            string
+	SpreadsheetId string
+	// set by the watcher once the channel is registered
+	ResourceId string
+	Expiration time.Time
+}
+
+// ChangeWatcher registers (and stops) the push notification channels
+type ChangeWatcher interface {
+	Watch(channel *WatchChannel, address, token string) error
+	Stop(channel *WatchChannel) error
+}
+
+// GoogleDriveWatcher watches spreadsheets for changes using drive's push
+// notifications (the service account needs read access to the drive files)
+type GoogleDriveWatcher struct {
+	svc *drive.Service
+}
+
+func NewGoogleDriveWatcherFromJSON(credentials string, client *http.Client) (*GoogleDriveWatcher, error) {
+	jwtcfg, err := google.JWTConfigFromJSON([]byte(credentials), drive.DriveReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(jwtcfg.Client(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve Drive Client: %v", err)
+	}
+	return &GoogleDriveWatcher{svc: svc}, nil
+}
+
+func (w *GoogleDriveWatcher) Watch(channel *WatchChannel, address, token string) error {
+	res, err := w.svc.Files.Watch(channel.SpreadsheetId, &drive.Channel{
+		Id:         channel.Id,
+		Type:       "web_hook",
+		Address:    address,
+		Token:      token,
+		Expiration: time.Now().Add(WatchChannelTTL).UnixMilli(),
+	}).Do()
+	if err != nil {
+		return err
+	}
+	channel.ResourceId = res.ResourceId
+	channel.Expiration = time.UnixMilli(res.Expiration)
+	return nil
+}
+
+func (w *GoogleDriveWatcher) Stop(channel *WatchChannel) error {
+	return w.svc.Channels.Stop(&drive.Channel{Id: channel.Id, ResourceId: channel.ResourceId}).Do()
+}
+
+// Watches keeps a channel open for each (google) spreadsheet of the config
+type Watches struct {
+	address string
+	secret  string
+	// the watcher of each spreadsheet (by id)
+	watchers map[string]ChangeWatcher
+	channels []*WatchChannel
+}
+
+// NewWatches creates the watchers of the config's spreadsheets (using the
+// credentials of their sheets); notifications are sent to the instance's
+// callback url
+func NewWatches(config *Config, client *http.Client) (*Watches, error) {
+	byCredentials := map[string]ChangeWatcher{}
+	watchers := map[string]ChangeWatcher{}
+	for _, sheet := range config.Sheets {
+		if sheet.Source != SourceGoogle || !sheet.IsEnabled() {
+			continue
+		}
+		if _, ok := watchers[sheet.SpreadsheetId]; ok {
+			continue
+		}
+		key := sheet.CredentialsKey()
+		watcher, ok := byCredentials[key]
+		if !ok {
+			credentials := config.Credentials
+			if key != "" {
+				var err error
+				if credentials, err = sheetCredentials(sheet); err != nil {
+					return nil, err
+				}
+			}
+			w, err := NewGoogleDriveWatcherFromJSON(credentials, client)
+			if err != nil {
+				return nil, fmt.Errorf("sheet %s: %v", sheet.Name, err)
+			}
+			watcher = w
+			byCredentials[key] = watcher
+		}
+		watchers[sheet.SpreadsheetId] = watcher
+	}
+	return newWatches(config, watchers), nil
+}
+
+func newWatches(config *Config, watchers map[string]ChangeWatcher) *Watches {
+	return &Watches{
+		address:  strings.TrimSuffix(config.CallbackURL, "/") + "/changes",
+		secret:   config.CallbackSecret,
+		watchers: watchers,
+	}
+}
+
+// watchToken is the token of a spreadsheet's channels (sent back by drive
+// with every notification): the spreadsheet id along with its signature
+// using the callback secret
+func watchToken(secret, spreadsheetId string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("changes\n" + spreadsheetId))
+	return spreadsheetId + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseWatchToken returns the spreadsheet of a valid token
+func parseWatchToken(secret, token string) (string, bool) {
+	idx := strings.LastIndex(token, ":")
+	if idx < 0 {
+		return "", false
+	}
+	spreadsheetId := token[:idx]
+	return spreadsheetId, hmac.Equal([]byte(token), []byte(watchToken(secret, spreadsheetId)))
+}
+
+// Start opens a channel for each spreadsheet; either all channels are open
+// or none is (so that the caller can fall back to polling)
+func (w *Watches) Start() error {
+	if len(w.watchers) == 0 {
+		return fmt.Errorf("there are no google spreadsheets to watch")
+	}
+	channels, err := w.open()
+	if err != nil {
+		return err
+	}
+	w.channels = channels
+	return nil
+}
+
+// open registers a new channel for each spreadsheet
+func (w *Watches) open() ([]*WatchChannel, error) {
+	channels := []*WatchChannel{}
+	for spreadsheetId, watcher := range w.watchers {
+		channel := &WatchChannel{Id: "remindme-" + newRunID() + newRunID(), SpreadsheetId: spreadsheetId}
+		if err := watcher.Watch(channel, w.address, watchToken(w.secret, spreadsheetId)); err != nil {
+			w.stop(channels)
+			return nil, fmt.Errorf("failed to watch spreadsheet %s: %v", spreadsheetId, err)
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// stop closes the channels (failures are only logged since the channels
+// expire anyway)
+func (w *Watches) stop(channels []*WatchChannel) {
+	for _, channel := range channels {
+		if err := w.watchers[channel.SpreadsheetId].Stop(channel); err != nil {
+			log.Printf("failed to stop watching spreadsheet %s: %v", channel.SpreadsheetId, err)
+		}
+	}
+}
+
+// Renew replaces the open channels with new ones (the old channels are
+// kept if that fails)
+func (w *Watches) Renew() error {
+	channels, err := w.open()
+	if err != nil {
+		return err
+	}
+	w.stop(w.channels)
+	w.channels = channels
+	return nil
+}
+
+// Len is the number of open channels
+func (w *Watches) Len() int {
+	return len(w.channels)
+}
+
+// Expiration returns when the first of the open channels expires
+func (w *Watches) Expiration() time.Time {
+	expiration := time.Time{}
+	for _, channel := range w.channels {
+		if expiration.IsZero() || channel.Expiration.Before(expiration) {
+			expiration = channel.Expiration
+		}
+	}
+	return expiration
+}
+
+// Keep renews the channels before they expire (it never returns)
+func (w *Watches) Keep() {
+	for {
+		// retry failed renewals every minute
+		wait := time.Until(w.Expiration().Add(-WatchRenewMargin))
+		if wait < time.Minute {
+			wait = time.Minute
+		}
+		time.Sleep(wait)
+		if err := w.Renew(); err != nil {
+			log.Printf("failed to renew watch channels: %v", err)
+		}
+	}
+}
+
+// WriteTracker records when the instance last wrote to each spreadsheet
+type WriteTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+	now  func() time.Time
+}
+
+func NewWriteTracker() *WriteTracker {
+	return &WriteTracker{last: map[string]time.Time{}, now: time.Now}
+}
+
+// Wrote records a write to the spreadsheet
+func (t *WriteTracker) Wrote(spreadsheetId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[spreadsheetId] = t.now()
+}
+
+// IsOwn reports whether the changes of the spreadsheet are (probably)
+// caused by the instance's writes, i.e. are within OwnWriteWindow of one
+func (t *WriteTracker) IsOwn(spreadsheetId string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.last[spreadsheetId]
+	return ok && t.now().Sub(last) < OwnWriteWindow
+}
+
+// Track records the writes of writer (nil writers are kept as such)
+func (t *WriteTracker) Track(writer SheetWriter) SheetWriter {
+	if writer == nil {
+		return nil
+	}
+	return &trackedWriter{writer: writer, tracker: t}
+}
+
+type trackedWriter struct {
+	writer  SheetWriter
+	tracker *WriteTracker
+}
+
+func (w *trackedWriter) MarkPaid(cell *PaidCell, date string) error {
+	// recorded first since the notification may arrive before the response
+	w.tracker.Wrote(cell.SpreadsheetId)
+	return w.writer.MarkPaid(cell, date)
+}
+
+// ChangeHandler receives drive's change notifications and triggers a run
+// unless the change was caused by the instance itself
+type ChangeHandler struct {
+	secret  string
+	writes  *WriteTracker
+	trigger func()
+}
+
+func NewChangeHandler(secret string, writes *WriteTracker, trigger func()) *ChangeHandler {
+	return &ChangeHandler{secret: secret, writes: writes, trigger: trigger}
+}
+
+func (h *ChangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	spreadsheetId, ok := parseWatchToken(h.secret, r.Header.Get("X-Goog-Channel-Token"))
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// the first notification of a channel only confirms that it is open
+	if state := r.Header.Get("X-Goog-Resource-State"); state == "sync" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if h.writes != nil && h.writes.IsOwn(spreadsheetId) {
+		log.Printf("ignoring change of spreadsheet %s (written by this instance)", spreadsheetId)
+	} else {
+		log.Printf("spreadsheet %s changed", spreadsheetId)
+		h.trigger()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Debounce returns a function that calls fn once it has not been called
+// for the given delay
+func Debounce(delay time.Duration, fn func()) func() {
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(delay, fn)
+	}
+}
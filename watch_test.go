@@ -0,0 +1,153 @@
+package remindme
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChangeWatcher struct {
+	watched []*WatchChannel
+	stopped []*WatchChannel
+	address string
+	token   string
+	err     error
+}
+
+func (w *fakeChangeWatcher) Watch(channel *WatchChannel, address, token string) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.address, w.token = address, token
+	channel.ResourceId = "resource-" + channel.SpreadsheetId
+	channel.Expiration = time.Now().Add(time.Hour)
+	w.watched = append(w.watched, channel)
+	return nil
+}
+
+func (w *fakeChangeWatcher) Stop(channel *WatchChannel) error {
+	w.stopped = append(w.stopped, channel)
+	return nil
+}
+
+func Test_Watches(t *testing.T) {
+	config := &Config{CallbackURL: "https://remindme.example.com/", CallbackSecret: "secret"}
+	watcher := &fakeChangeWatcher{}
+	watches := newWatches(config, map[string]ChangeWatcher{"abc": watcher})
+
+	require.NoError(t, watches.Start())
+	require.Len(t, watcher.watched, 1)
+	assert.Equal(t, "abc", watcher.watched[0].SpreadsheetId)
+	assert.Equal(t, "https://remindme.example.com/changes", watcher.address)
+	assert.Equal(t, watchToken("secret", "abc"), watcher.token)
+	assert.Equal(t, watcher.watched[0].Expiration, watches.Expiration())
+
+	// the old channel is stopped once the new one is open
+	first := watcher.watched[0]
+	require.NoError(t, watches.Renew())
+	require.Len(t, watcher.watched, 2)
+	assert.NotEqual(t, first.Id, watcher.watched[1].Id)
+	assert.Equal(t, []*WatchChannel{first}, watcher.stopped)
+
+	// the open channels are kept when renewing fails
+	watcher.err = errors.New("boom")
+	assert.Error(t, watches.Renew())
+	assert.Equal(t, []*WatchChannel{watcher.watched[1]}, watches.channels)
+
+	// there is nothing to watch without google spreadsheets
+	assert.Error(t, newWatches(config, map[string]ChangeWatcher{}).Start())
+}
+
+func Test_Watches_StartFailure(t *testing.T) {
+	config := &Config{CallbackURL: "https://remindme.example.com", CallbackSecret: "secret"}
+	ok := &fakeChangeWatcher{}
+	failing := &fakeChangeWatcher{err: errors.New("boom")}
+	watches := newWatches(config, map[string]ChangeWatcher{"abc": ok, "xyz": failing})
+
+	assert.ErrorContains(t, watches.Start(), "boom")
+	// the channels that were opened are stopped
+	assert.Equal(t, ok.watched, ok.stopped)
+	assert.Empty(t, watches.channels)
+}
+
+func Test_ChangeHandler(t *testing.T) {
+	triggered := 0
+	now := time.Date(2023, time.November, 15, 9, 0, 0, 0, time.UTC)
+	writes := NewWriteTracker()
+	writes.now = func() time.Time { return now }
+	handler := NewChangeHandler("secret", writes, func() { triggered++ })
+	kases := []struct {
+		method    string
+		token     string
+		state     string
+		status    int
+		triggered int
+	}{
+		{http.MethodGet, watchToken("secret", "abc"), "update", http.StatusMethodNotAllowed, 0},
+		{http.MethodPost, "foo", "update", http.StatusForbidden, 0},
+		{http.MethodPost, watchToken("other", "abc"), "update", http.StatusForbidden, 0},
+		{http.MethodPost, "xyz" + watchToken("secret", "abc")[3:], "update", http.StatusForbidden, 0},
+		{http.MethodPost, watchToken("secret", "abc"), "sync", http.StatusOK, 0},
+		{http.MethodPost, watchToken("secret", "abc"), "update", http.StatusOK, 1},
+	}
+	send := func(method, token, state string) int {
+		req := httptest.NewRequest(method, "/changes", nil)
+		req.Header.Set("X-Goog-Channel-Token", token)
+		req.Header.Set("X-Goog-Resource-State", state)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, kase := range kases {
+		assert.Equal(t, kase.status, send(kase.method, kase.token, kase.state), kase)
+		assert.Equal(t, kase.triggered, triggered, kase)
+	}
+
+	// changes caused by the instance's own writes are ignored for a while
+	writer := writes.Track(&fakeSheetWriter{paid: map[string]string{}})
+	require.NoError(t, writer.MarkPaid(&PaidCell{SpreadsheetId: "abc", Sheet: "household", Cell: "C2"}, "2023-11-15"))
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, watchToken("secret", "abc"), "update"))
+	assert.Equal(t, 1, triggered)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, watchToken("secret", "xyz"), "update"))
+	assert.Equal(t, 2, triggered)
+	now = now.Add(OwnWriteWindow)
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, watchToken("secret", "abc"), "update"))
+	assert.Equal(t, 3, triggered)
+	assert.Nil(t, writes.Track(nil))
+}
+
+func Test_Debounce(t *testing.T) {
+	var calls atomic.Int32
+	fn := Debounce(50*time.Millisecond, func() { calls.Add(1) })
+	for i := 0; i < 5; i++ {
+		fn()
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func Test_ParseConfig_WatchChanges(t *testing.T) {
+	_, err := ParseConfig([]byte("watch_changes: true"))
+	assert.Error(t, err)
+
+	config, err := ParseConfig([]byte("watch_changes: true\ncallback_url: https://remindme.example.com\ncallback_secret: secret"))
+	require.NoError(t, err)
+	assert.True(t, config.WatchChanges)
+
+	// the server only receives changes when they are watched
+	server := NewServer(time.Now)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/changes", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	server.WithChangeHandler(NewChangeHandler("secret", nil, func() {}))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/changes", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
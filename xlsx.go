@@ -0,0 +1,117 @@
+package remindme
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXSheetReader reads the worksheets of local excel (.xlsx) files
+type XLSXSheetReader struct{}
+
+func (r *XLSXSheetReader) Read(path string, sheetNames ...string) (map[string][][]interface{}, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	props, err := f.GetWorkbookProps()
+	if err != nil {
+		return nil, err
+	}
+	date1904 := props.Date1904 != nil && *props.Date1904
+
+	values := map[string][][]interface{}{}
+	for _, name := range sheetNames {
+		rows, err := readXLSXSheet(f, name, date1904)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = rows
+	}
+	return values, nil
+}
+
+// List returns the names of the file's worksheets
+func (r *XLSXSheetReader) List(path string) ([]string, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.GetSheetList(), nil
+}
+
+// readXLSXSheet loads the rows of a worksheet in the shape of the sheets
+// api values; dates are stored as numbers in excel so the cells with a
+// date format are converted to YYYY-MM-DD (with the time if there is one)
+func readXLSXSheet(f *excelize.File, name string, date1904 bool) ([][]interface{}, error) {
+	records, err := f.GetRows(name, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	rows := [][]interface{}{}
+	for r, record := range records {
+		row := []interface{}{}
+		for c, cell := range record {
+			if serial, err := strconv.ParseFloat(cell, 64); err == nil {
+				if date, ok, err := xlsxDate(f, name, c+1, r+1, serial, date1904); err != nil {
+					return nil, err
+				} else if ok {
+					cell = date
+				}
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// xlsxDate formats the serial number of the cell as a date if the cell has
+// a date format
+func xlsxDate(f *excelize.File, sheet string, col, row int, serial float64, date1904 bool) (string, bool, error) {
+	cell, err := excelize.CoordinatesToCellName(col, row)
+	if err != nil {
+		return "", false, err
+	}
+	idx, err := f.GetCellStyle(sheet, cell)
+	if err != nil {
+		return "", false, err
+	}
+	style, err := f.GetStyle(idx)
+	if err != nil {
+		return "", false, err
+	}
+	if !isDateNumFmt(style) {
+		return "", false, nil
+	}
+	t, err := excelize.ExcelDateToTime(serial, date1904)
+	if err != nil {
+		return "", false, err
+	}
+	if serial == math.Trunc(serial) {
+		return t.Format(time.DateOnly), true, nil
+	}
+	return t.Format("2006-01-02 15:04"), true, nil
+}
+
+// literals (quoted or escaped text) and [..] sections (colors, locales
+// etc.) of number format codes
+var numFmtLiterals = regexp.MustCompile(`"[^"]*"|\\.|\[[^\]]*\]`)
+
+// isDateNumFmt reports whether the style's number format is a date (or
+// date time) format
+func isDateNumFmt(style *excelize.Style) bool {
+	if style.CustomNumFmt != nil {
+		code := strings.ToLower(numFmtLiterals.ReplaceAllString(*style.CustomNumFmt, ""))
+		return strings.ContainsAny(code, "yd")
+	}
+	// the built-in date and date time formats
+	return (style.NumFmt >= 14 && style.NumFmt <= 17) || style.NumFmt == 22
+}
@@ -0,0 +1,57 @@
+package remindme
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func Test_XLSXSheetReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.xlsx")
+	f := excelize.NewFile()
+	require.NoError(t, f.SetSheetName("Sheet1", "payments"))
+	dateFmt := "dd/mm/yyyy"
+	style, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt})
+	require.NoError(t, err)
+	cells := map[string]interface{}{
+		"A1": "Description", "B1": "Due Date", "C1": "Payment Date", "D1": "Amount",
+		"A2": "foo", "B2": time.Date(2023, time.November, 4, 0, 0, 0, 0, time.UTC), "D2": 12.5,
+		"A3": "bar", "B3": time.Date(2023, time.November, 5, 0, 0, 0, 0, time.UTC), "C3": "2023-11-05",
+		"A4": "baz", "B4": 45236,
+	}
+	for cell, value := range cells {
+		require.NoError(t, f.SetCellValue("payments", cell, value))
+	}
+	require.NoError(t, f.SetCellStyle("payments", "B4", "B4", style))
+	require.NoError(t, f.SaveAs(path))
+	require.NoError(t, f.Close())
+
+	reader := &XLSXSheetReader{}
+	names, err := reader.List(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payments"}, names)
+
+	values, err := reader.Read(path, "payments")
+	require.NoError(t, err)
+	rows := values["payments"]
+	require.Equal(t, 4, len(rows))
+	assert.Equal(t, []interface{}{"foo", "2023-11-04", "", "12.5"}, rows[1])
+	// a number with a (custom) date format is a date
+	assert.Equal(t, []interface{}{"baz", "2023-11-06"}, rows[3])
+
+	payments, err := readPayments(rows, &Sheet{Source: SourceXLSX, Path: path}, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(payments))
+	assert.Equal(t, "foo", payments[0].description)
+	assert.Equal(t, 12.5, payments[0].amount)
+	assert.Equal(t, "baz", payments[1].description)
+
+	_, err = reader.Read(path, "missing")
+	assert.Error(t, err)
+	_, err = reader.Read(filepath.Join(t.TempDir(), "missing.xlsx"), "payments")
+	assert.Error(t, err)
+}